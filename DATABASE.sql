@@ -5,5 +5,16 @@ CREATE TABLE companies (
     code TEXT NOT NULL,
     country TEXT NOT NULL,
     website TEXT,
-    phone TEXT
+    phone TEXT,
+    version INTEGER NOT NULL DEFAULT 1,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
 );
+CREATE TABLE idempotency_keys (
+    key TEXT PRIMARY KEY,
+    fingerprint TEXT NOT NULL,
+    status INTEGER NOT NULL,
+    content_type TEXT NOT NULL,
+    body BYTEA NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX idempotency_keys_created_at ON idempotency_keys (created_at);
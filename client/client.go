@@ -0,0 +1,292 @@
+// Package client is a Go client for the companies API. Errors reported by the API
+// are returned as types.ErrNotFound, types.ErrAlreadyExists and types.ErrVersionMismatch
+// where applicable, all the others as *Error.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/irmatov/companies/problem"
+	"github.com/irmatov/companies/types"
+)
+
+const companiesPath = "/v1/companies/"
+
+// Client performs requests to the companies API.
+type Client struct {
+	// BaseURL is the URL of the API root, e.g. http://localhost:8080.
+	BaseURL string
+	// HTTPClient is used to perform requests, http.DefaultClient if nil.
+	HTTPClient *http.Client
+	// Header is added to every request, e.g. to pass credentials.
+	Header http.Header
+}
+
+// New creates a new client for the API at baseURL.
+func New(baseURL string) *Client {
+	return &Client{BaseURL: strings.TrimSuffix(baseURL, "/")}
+}
+
+// Error is an error reported by the API.
+type Error struct {
+	StatusCode int
+	// Problem is set if the API has provided problem details.
+	Problem *problem.Problem
+}
+
+func (e *Error) Error() string {
+	if e.Problem != nil {
+		return fmt.Sprintf("companies API: %d %s", e.StatusCode, e.Problem.Error())
+	}
+	return fmt.Sprintf("companies API: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// ListOptions control which companies List returns.
+type ListOptions struct {
+	// Filter is a filter expression as understood by the filter package, e.g. country,"CY",=
+	Filter string
+	// Sort lists the fields to order the companies by instead of the name, descending
+	// ones are prefixed with "-", e.g. {"country", "-name"}.
+	Sort []string
+	// Limit is the maximum number of companies to return, zero means no limit.
+	Limit int
+	// Offset is the number of companies to skip.
+	Offset int
+}
+
+// query returns the query parameters for the options. Sort, Limit and Offset are not
+// available for exports.
+func (o ListOptions) query() url.Values {
+	q := url.Values{}
+	if o.Filter != "" {
+		q.Set("filter", o.Filter)
+	}
+	if len(o.Sort) > 0 {
+		q.Set("sort", strings.Join(o.Sort, ","))
+	}
+	if o.Limit > 0 {
+		q.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if o.Offset > 0 {
+		q.Set("offset", strconv.Itoa(o.Offset))
+	}
+	return q
+}
+
+// CompanyPatch lists company attributes to change, nil ones are left intact.
+type CompanyPatch struct {
+	Name    *string `json:",omitempty"`
+	Code    *string `json:",omitempty"`
+	Country *string `json:",omitempty"`
+	Website *string `json:",omitempty"`
+	Phone   *string `json:",omitempty"`
+}
+
+// Get returns the company with the given id.
+func (c *Client) Get(ctx context.Context, id int) (types.Company, error) {
+	var company types.Company
+	err := c.do(ctx, http.MethodGet, companiesPath+strconv.Itoa(id), nil, nil, &company)
+	return company, err
+}
+
+// List returns the companies matching the options, ordered by name unless opts.Sort
+// says otherwise.
+func (c *Client) List(ctx context.Context, opts ListOptions) ([]types.Company, error) {
+	path := companiesPath
+	if q := opts.query(); len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+	var companies []types.Company
+	err := c.do(ctx, http.MethodGet, path, nil, nil, &companies)
+	return companies, err
+}
+
+// Create creates a new company and returns its id.
+func (c *Client) Create(ctx context.Context, company types.Company) (int, error) {
+	var created struct {
+		Id int
+	}
+	err := c.do(ctx, http.MethodPost, companiesPath, nil, company, &created)
+	return created.Id, err
+}
+
+// Update replaces the company. If company.Version is not zero, the update only
+// succeeds if the stored company has the same version.
+func (c *Client) Update(ctx context.Context, company types.Company) error {
+	return c.do(ctx, http.MethodPut, companiesPath+strconv.Itoa(company.Id), ifMatch(company.Version), company, nil)
+}
+
+// Patch changes some attributes of the company with the given id. If version is not
+// zero, the change only succeeds if the stored company has the same version.
+func (c *Client) Patch(ctx context.Context, id int, version int, patch CompanyPatch) error {
+	return c.do(ctx, http.MethodPatch, companiesPath+strconv.Itoa(id), ifMatch(version), patch, nil)
+}
+
+// Delete deletes the company with the given id. If version is not zero, the company
+// is only deleted if it has the same version.
+func (c *Client) Delete(ctx context.Context, id int, version int) error {
+	return c.do(ctx, http.MethodDelete, companiesPath+strconv.Itoa(id), ifMatch(version), nil, nil)
+}
+
+func ifMatch(version int) http.Header {
+	if version == 0 {
+		return nil
+	}
+	return http.Header{"If-Match": {fmt.Sprintf(`"%d"`, version)}}
+}
+
+// do performs a request with a JSON body, unless in is nil, and decodes a JSON response into out,
+// unless it is nil.
+func (c *Client) do(ctx context.Context, method, path string, header http.Header, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := c.newRequest(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.send(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (c *Client) newRequest(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range c.Header {
+		req.Header[k] = v
+	}
+	return req, nil
+}
+
+// send performs the request and converts unsuccessful responses to errors.
+func (c *Client) send(req *http.Request) (*http.Response, error) {
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 400 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return nil, types.ErrNotFound
+	case http.StatusConflict:
+		return nil, types.ErrAlreadyExists
+	case http.StatusPreconditionFailed:
+		return nil, types.ErrVersionMismatch
+	}
+	apiErr := &Error{StatusCode: resp.StatusCode}
+	if mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mt == problem.ContentType {
+		var p problem.Problem
+		if json.NewDecoder(resp.Body).Decode(&p) == nil {
+			apiErr.Problem = &p
+		}
+	}
+	return nil, apiErr
+}
+
+// ImportOptions control the behaviour of Import.
+type ImportOptions struct {
+	// DryRun makes the API report the outcome without storing anything.
+	DryRun bool
+	// Upsert makes the API update existing companies with the same name.
+	Upsert bool
+}
+
+// ImportResult is the outcome of a CSV import.
+type ImportResult struct {
+	DryRun    bool
+	Created   int
+	Updated   int
+	Unchanged int
+	Failed    int
+	Rows      []ImportRow
+}
+
+// ImportRow is the outcome of importing a single CSV record.
+type ImportRow struct {
+	Line   int
+	Id     int
+	Action string
+	Error  *problem.Problem
+}
+
+// Import imports companies from CSV data with a header row.
+func (c *Client) Import(ctx context.Context, csv io.Reader, opts ImportOptions) (ImportResult, error) {
+	q := url.Values{}
+	if opts.DryRun {
+		q.Set("dry_run", "true")
+	}
+	if opts.Upsert {
+		q.Set("mode", "upsert")
+	}
+	req, err := c.newRequest(ctx, http.MethodPost, companiesPath+"_import?"+q.Encode(), csv)
+	if err != nil {
+		return ImportResult{}, err
+	}
+	req.Header.Set("Content-Type", "text/csv")
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.send(req)
+	if err != nil {
+		return ImportResult{}, err
+	}
+	defer resp.Body.Close()
+	var result ImportResult
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	return result, err
+}
+
+// Export writes the companies matching the options to w in the given format: json,
+// csv, ndjson or xml. The companies are streamed, so exports of any size are possible,
+// but they can not be sorted or paged.
+func (c *Client) Export(ctx context.Context, w io.Writer, format string, opts ListOptions) error {
+	q := opts.query()
+	q.Set("format", format)
+	q.Set("stream", "true")
+	req, err := c.newRequest(ctx, http.MethodGet, companiesPath+"?"+q.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.send(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
@@ -0,0 +1,166 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/irmatov/companies/mockdb"
+	"github.com/irmatov/companies/problem"
+	"github.com/irmatov/companies/server"
+	"github.com/irmatov/companies/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient(t *testing.T) {
+	ts := httptest.NewServer(server.New(mockdb.New()))
+	defer ts.Close()
+	c := New(ts.URL + "/")
+	ctx := context.Background()
+
+	c1 := types.Company{
+		Name:    "Hydrogen",
+		Code:    "HYDRO",
+		Country: "CY",
+		Website: "https://hydrogen.io/",
+		Phone:   "+35722123456",
+	}
+	var err error
+	c1.Id, err = c.Create(ctx, c1)
+	require.NoError(t, err)
+	c1.Version = 1
+
+	c2 := types.Company{Name: "Helium", Code: "HE", Country: "FR"}
+	c2.Id, err = c.Create(ctx, c2)
+	require.NoError(t, err)
+	c2.Version = 1
+
+	t.Run("create conflict", func(t *testing.T) {
+		conflict := c1
+		conflict.Code = "OTHER"
+		_, err := c.Create(ctx, conflict)
+		assert.Equal(t, types.ErrAlreadyExists, err)
+	})
+
+	t.Run("create invalid", func(t *testing.T) {
+		_, err := c.Create(ctx, types.Company{Name: "Invalid", Code: "INV", Country: "XX"})
+		apiErr, ok := err.(*Error)
+		require.True(t, ok, "unexpected error %v", err)
+		assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+		require.NotNil(t, apiErr.Problem)
+		assert.Equal(t, problem.CodeValidationFailed, apiErr.Problem.Code)
+		assert.Equal(t, "country", apiErr.Problem.Errors[0].Field)
+	})
+
+	t.Run("get", func(t *testing.T) {
+		got, err := c.Get(ctx, c1.Id)
+		require.NoError(t, err)
+		assert.Equal(t, c1, got)
+
+		_, err = c.Get(ctx, 999)
+		assert.Equal(t, types.ErrNotFound, err)
+	})
+
+	t.Run("list", func(t *testing.T) {
+		got, err := c.List(ctx, ListOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, []types.Company{c1, c2}, got)
+
+		got, err = c.List(ctx, ListOptions{Filter: `name,"Helium",=`})
+		require.NoError(t, err)
+		assert.Equal(t, []types.Company{c2}, got)
+
+		got, err = c.List(ctx, ListOptions{Sort: []string{"-name"}, Limit: 1})
+		require.NoError(t, err)
+		assert.Equal(t, []types.Company{c1}, got)
+
+		got, err = c.List(ctx, ListOptions{Sort: []string{"name"}, Offset: 1})
+		require.NoError(t, err)
+		assert.Equal(t, []types.Company{c1}, got)
+
+		_, err = c.List(ctx, ListOptions{Sort: []string{"size"}})
+		apiErr, ok := err.(*Error)
+		require.True(t, ok, "unexpected error %v", err)
+		assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+	})
+
+	t.Run("update", func(t *testing.T) {
+		c1.Website = "https://hydrogen.com/"
+		require.NoError(t, c.Update(ctx, c1))
+		c1.Version = 2
+
+		stale := c1
+		stale.Version = 1
+		assert.Equal(t, types.ErrVersionMismatch, c.Update(ctx, stale))
+
+		got, err := c.Get(ctx, c1.Id)
+		require.NoError(t, err)
+		assert.Equal(t, c1, got)
+	})
+
+	t.Run("patch", func(t *testing.T) {
+		phone := "+33123456789"
+		assert.Equal(t, types.ErrVersionMismatch, c.Patch(ctx, c2.Id, 5, CompanyPatch{Phone: &phone}))
+		require.NoError(t, c.Patch(ctx, c2.Id, c2.Version, CompanyPatch{Phone: &phone}))
+		c2.Phone = phone
+		c2.Version = 2
+
+		got, err := c.Get(ctx, c2.Id)
+		require.NoError(t, err)
+		assert.Equal(t, c2, got)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		assert.Equal(t, types.ErrVersionMismatch, c.Delete(ctx, c2.Id, 1))
+		require.NoError(t, c.Delete(ctx, c2.Id, c2.Version))
+		assert.Equal(t, types.ErrNotFound, c.Delete(ctx, c2.Id, 0))
+	})
+
+	t.Run("credentials", func(t *testing.T) {
+		var got string
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = r.Header.Get("Authorization")
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte("[]"))
+		}))
+		defer ts.Close()
+		c := New(ts.URL)
+		c.Header = http.Header{"Authorization": {"Bearer secret"}}
+		_, err := c.List(ctx, ListOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "Bearer secret", got)
+	})
+}
+
+func TestClientImportExport(t *testing.T) {
+	ts := httptest.NewServer(server.New(mockdb.New()))
+	defer ts.Close()
+	c := New(ts.URL)
+	ctx := context.Background()
+	const data = "name,code,country\nHydrogen,HYDRO,CY\nHelium,HE,Atlantis\n"
+
+	result, err := c.Import(ctx, strings.NewReader(data), ImportOptions{DryRun: true})
+	require.NoError(t, err)
+	assert.True(t, result.DryRun)
+	assert.Equal(t, 1, result.Created)
+	assert.Equal(t, 1, result.Failed)
+	require.NotNil(t, result.Rows[1].Error)
+	assert.Equal(t, problem.CodeValidationFailed, result.Rows[1].Error.Code)
+
+	result, err = c.Import(ctx, strings.NewReader(data), ImportOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Created)
+
+	var buf bytes.Buffer
+	require.NoError(t, c.Export(ctx, &buf, "csv", ListOptions{}))
+	assert.Equal(t, "id,name,code,country,website,phone,version\n1,Hydrogen,HYDRO,CY,,,1\n", buf.String())
+
+	err = c.Export(ctx, &buf, "yaml", ListOptions{})
+	apiErr, ok := err.(*Error)
+	require.True(t, ok, "unexpected error %v", err)
+	assert.Equal(t, http.StatusNotAcceptable, apiErr.StatusCode)
+}
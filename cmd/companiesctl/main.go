@@ -0,0 +1,356 @@
+// Command companiesctl queries and edits companies through the companies API.
+//
+// Usage:
+//
+//	companiesctl [-url URL] [-token TOKEN] [-config FILE] command [arguments]
+//
+// The API location and credentials are taken from the flags, then from COMPANIES_URL
+// and COMPANIES_TOKEN environment variables and finally from the configuration file,
+// $HOME/.config/companiesctl/config.json by default:
+//
+//	{"url": "https://companies.example.com", "token": "secret"}
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/irmatov/companies/client"
+	"github.com/irmatov/companies/companycsv"
+	"github.com/irmatov/companies/problem"
+	"github.com/irmatov/companies/types"
+)
+
+const defaultURL = "http://localhost:8080"
+
+const usage = `usage: companiesctl [-url URL] [-token TOKEN] [-config FILE] command [arguments]
+
+commands:
+  list [-filter EXPR] [-sort FIELDS] [-limit N] [-offset N] [-o table|json|csv]
+  get [-o table|json|csv] ID
+  create -name NAME -code CODE -country COUNTRY [-website URL] [-phone PHONE]
+  update [-version N] [-name NAME] [-code CODE] [-country COUNTRY] [-website URL] [-phone PHONE] ID
+  delete [-version N] ID
+  import [-dry-run] [-upsert] FILE
+  export [-filter EXPR] [-format json|csv|ndjson|xml]
+
+FILE may be - to read from the standard input. EXPR is a filter expression, e.g. country,"CY",=
+`
+
+// errUsage is returned when the command line is not valid.
+var errUsage = errors.New("invalid usage")
+
+// config holds the API location and credentials.
+type config struct {
+	URL   string `json:"url"`
+	Token string `json:"token"`
+}
+
+// cli runs commands writing the results to stdout.
+type cli struct {
+	client *client.Client
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+var commands = map[string]func(c *cli, args []string) error{
+	"list":   (*cli).list,
+	"get":    (*cli).get,
+	"create": (*cli).create,
+	"update": (*cli).update,
+	"delete": (*cli).delete,
+	"import": (*cli).importCSV,
+	"export": (*cli).export,
+}
+
+func main() {
+	err := run(os.Args[1:], os.Getenv, os.Stdin, os.Stdout, os.Stderr)
+	if err == errUsage {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "companiesctl:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, getenv func(string) string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("companiesctl", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	url := fs.String("url", "", "API base URL")
+	token := fs.String("token", "", "API bearer token")
+	configPath := fs.String("config", "", "configuration file")
+	if err := fs.Parse(args); err != nil || fs.NArg() == 0 {
+		return errUsage
+	}
+	cmd, ok := commands[fs.Arg(0)]
+	if !ok {
+		return errUsage
+	}
+
+	cfg, err := loadConfig(*configPath, getenv)
+	if err != nil {
+		return err
+	}
+	if *url != "" {
+		cfg.URL = *url
+	}
+	if *token != "" {
+		cfg.Token = *token
+	}
+	c := &cli{client: client.New(cfg.URL), stdin: stdin, stdout: stdout, stderr: stderr}
+	if cfg.Token != "" {
+		c.client.Header = map[string][]string{"Authorization": {"Bearer " + cfg.Token}}
+	}
+	return cmd(c, fs.Args()[1:])
+}
+
+// loadConfig reads the configuration file, if any, and overrides it with the environment.
+func loadConfig(path string, getenv func(string) string) (config, error) {
+	cfg := config{URL: defaultURL}
+	explicit := path != ""
+	if !explicit {
+		if home := getenv("HOME"); home != "" {
+			path = filepath.Join(home, ".config", "companiesctl", "config.json")
+		}
+	}
+	if path != "" {
+		b, err := os.ReadFile(path)
+		switch {
+		case err == nil:
+			if err := json.Unmarshal(b, &cfg); err != nil {
+				return config{}, fmt.Errorf("%s: %w", path, err)
+			}
+		case explicit || !errors.Is(err, os.ErrNotExist):
+			return config{}, err
+		}
+	}
+	if v := getenv("COMPANIES_URL"); v != "" {
+		cfg.URL = v
+	}
+	if v := getenv("COMPANIES_TOKEN"); v != "" {
+		cfg.Token = v
+	}
+	return cfg, nil
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+// parseId parses the only positional argument as a company id.
+func parseId(fs *flag.FlagSet) (int, error) {
+	if fs.NArg() != 1 {
+		return 0, errUsage
+	}
+	id, err := strconv.Atoi(fs.Arg(0))
+	if err != nil {
+		return 0, fmt.Errorf("invalid company id %q", fs.Arg(0))
+	}
+	return id, nil
+}
+
+func (c *cli) list(args []string) error {
+	fs := newFlagSet("list")
+	filter := fs.String("filter", "", "filter expression")
+	sort := fs.String("sort", "", "comma separated fields to order by, - prefix for descending")
+	limit := fs.Int("limit", 0, "maximum number of companies")
+	offset := fs.Int("offset", 0, "number of companies to skip")
+	output := fs.String("o", "table", "output format: table, json or csv")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		return errUsage
+	}
+	opts := client.ListOptions{Filter: *filter, Limit: *limit, Offset: *offset}
+	if *sort != "" {
+		opts.Sort = strings.Split(*sort, ",")
+	}
+	companies, err := c.client.List(context.Background(), opts)
+	if err != nil {
+		return err
+	}
+	return c.print(*output, companies)
+}
+
+func (c *cli) get(args []string) error {
+	fs := newFlagSet("get")
+	output := fs.String("o", "table", "output format: table, json or csv")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	id, err := parseId(fs)
+	if err != nil {
+		return err
+	}
+	company, err := c.client.Get(context.Background(), id)
+	if err != nil {
+		return err
+	}
+	return c.print(*output, []types.Company{company})
+}
+
+func (c *cli) create(args []string) error {
+	fs := newFlagSet("create")
+	var company types.Company
+	fs.StringVar(&company.Name, "name", "", "company name")
+	fs.StringVar(&company.Code, "code", "", "company code")
+	fs.StringVar(&company.Country, "country", "", "ISO 3166-1 alpha-2 country code")
+	fs.StringVar(&company.Website, "website", "", "website URL")
+	fs.StringVar(&company.Phone, "phone", "", "phone number")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		return errUsage
+	}
+	id, err := c.client.Create(context.Background(), company)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(c.stdout, id)
+	return nil
+}
+
+// update changes only the attributes given on the command line.
+func (c *cli) update(args []string) error {
+	fs := newFlagSet("update")
+	version := fs.Int("version", 0, "expected company version")
+	fs.String("name", "", "company name")
+	fs.String("code", "", "company code")
+	fs.String("country", "", "ISO 3166-1 alpha-2 country code")
+	fs.String("website", "", "website URL")
+	fs.String("phone", "", "phone number")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	id, err := parseId(fs)
+	if err != nil {
+		return err
+	}
+	var patch client.CompanyPatch
+	fields := map[string]**string{
+		"name":    &patch.Name,
+		"code":    &patch.Code,
+		"country": &patch.Country,
+		"website": &patch.Website,
+		"phone":   &patch.Phone,
+	}
+	var changed bool
+	fs.Visit(func(f *flag.Flag) {
+		if field, ok := fields[f.Name]; ok {
+			value := f.Value.String()
+			*field = &value
+			changed = true
+		}
+	})
+	if !changed {
+		return errors.New("nothing to update")
+	}
+	return c.client.Patch(context.Background(), id, *version, patch)
+}
+
+func (c *cli) delete(args []string) error {
+	fs := newFlagSet("delete")
+	version := fs.Int("version", 0, "expected company version")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	id, err := parseId(fs)
+	if err != nil {
+		return err
+	}
+	return c.client.Delete(context.Background(), id, *version)
+}
+
+func (c *cli) importCSV(args []string) error {
+	fs := newFlagSet("import")
+	var opts client.ImportOptions
+	fs.BoolVar(&opts.DryRun, "dry-run", false, "report the outcome without storing anything")
+	fs.BoolVar(&opts.Upsert, "upsert", false, "update existing companies with the same name")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+		return errUsage
+	}
+	in := c.stdin
+	if name := fs.Arg(0); name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	result, err := c.client.Import(context.Background(), in, opts)
+	if err != nil {
+		return err
+	}
+	for _, row := range result.Rows {
+		if row.Error != nil {
+			fmt.Fprintf(c.stderr, "line %d: %s\n", row.Line, problemText(row.Error))
+		}
+	}
+	fmt.Fprintf(c.stdout, "created: %d, updated: %d, unchanged: %d, failed: %d\n",
+		result.Created, result.Updated, result.Unchanged, result.Failed)
+	if result.DryRun {
+		fmt.Fprintln(c.stdout, "dry run, nothing has been stored")
+	}
+	if result.Failed > 0 {
+		return errors.New("some records have not been imported")
+	}
+	return nil
+}
+
+func (c *cli) export(args []string) error {
+	fs := newFlagSet("export")
+	filter := fs.String("filter", "", "filter expression")
+	format := fs.String("format", "csv", "export format: json, csv, ndjson or xml")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		return errUsage
+	}
+	return c.client.Export(context.Background(), c.stdout, *format, client.ListOptions{Filter: *filter})
+}
+
+// problemText describes the problem including its field errors.
+func problemText(p *problem.Problem) string {
+	text := p.Error()
+	for _, fe := range p.Errors {
+		text += fmt.Sprintf("; %s: %s", fe.Field, fe.Message)
+	}
+	return text
+}
+
+// print writes the companies in the given output format.
+func (c *cli) print(output string, companies []types.Company) error {
+	switch output {
+	case "table":
+		tw := tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tNAME\tCODE\tCOUNTRY\tWEBSITE\tPHONE\tVERSION")
+		for _, company := range companies {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%d\n", company.Id, company.Name, company.Code,
+				company.Country, company.Website, company.Phone, company.Version)
+		}
+		return tw.Flush()
+	case "json":
+		enc := json.NewEncoder(c.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(companies)
+	case "csv":
+		w := companycsv.NewWriter(c.stdout)
+		for _, company := range companies {
+			if err := w.Write(company); err != nil {
+				return err
+			}
+		}
+		return w.Flush()
+	default:
+		return fmt.Errorf("unknown output format %q", output)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/irmatov/companies/mockdb"
+	"github.com/irmatov/companies/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	ts := httptest.NewServer(server.New(mockdb.New()))
+	defer ts.Close()
+	env := map[string]string{"COMPANIES_URL": ts.URL}
+	ctl := func(stdin string, args ...string) (string, error) {
+		var stdout, stderr bytes.Buffer
+		err := run(args, func(k string) string { return env[k] }, strings.NewReader(stdin), &stdout, &stderr)
+		return stdout.String(), err
+	}
+
+	out, err := ctl("", "create", "-name", "Hydrogen", "-code", "HYDRO", "-country", "CY")
+	require.NoError(t, err)
+	assert.Equal(t, "1\n", out)
+
+	_, err = ctl("", "update", "-version", "1", "-phone", "+35722123456", "1")
+	require.NoError(t, err)
+
+	out, err = ctl("", "get", "-o", "csv", "1")
+	require.NoError(t, err)
+	assert.Equal(t, "id,name,code,country,website,phone,version\n1,Hydrogen,HYDRO,CY,,+35722123456,2\n", out)
+
+	out, err = ctl("name,code,country\nHelium,HE,FR\nInvalid,INV,XX\n", "import", "-dry-run", "-")
+	assert.EqualError(t, err, "some records have not been imported")
+	assert.Equal(t, "created: 1, updated: 0, unchanged: 0, failed: 1\ndry run, nothing has been stored\n", out)
+
+	out, err = ctl("name,code,country\nHelium,HE,FR\n", "import", "-")
+	require.NoError(t, err)
+	assert.Equal(t, "created: 1, updated: 0, unchanged: 0, failed: 0\n", out)
+
+	out, err = ctl("", "list")
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	require.Len(t, lines, 3)
+	assert.True(t, strings.HasPrefix(lines[0], "ID"))
+	assert.Contains(t, lines[2], "Helium")
+
+	out, err = ctl("", "export", "-format", "ndjson")
+	require.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(out, "\n"))
+
+	out, err = ctl("", "list", "-o", "json")
+	require.NoError(t, err)
+	assert.Contains(t, out, `"Name": "Helium"`)
+
+	out, err = ctl("", "list", "-sort", "-name", "-limit", "1")
+	require.NoError(t, err)
+	lines = strings.Split(strings.TrimSpace(out), "\n")
+	require.Len(t, lines, 2)
+	assert.Contains(t, lines[1], "Hydrogen")
+
+	_, err = ctl("", "delete", "-version", "1", "1")
+	assert.Error(t, err)
+	_, err = ctl("", "delete", "-version", "2", "1")
+	require.NoError(t, err)
+	_, err = ctl("", "get", "1")
+	assert.Error(t, err)
+
+	_, err = ctl("", "frobnicate")
+	assert.Equal(t, errUsage, err)
+	_, err = ctl("", "get")
+	assert.Equal(t, errUsage, err)
+}
+
+func TestConfig(t *testing.T) {
+	var auth string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("[]"))
+	}))
+	defer ts.Close()
+
+	home := t.TempDir()
+	dir := filepath.Join(home, ".config", "companiesctl")
+	require.NoError(t, os.MkdirAll(dir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config.json"), []byte(`{"url": "`+ts.URL+`", "token": "file"}`), 0o600))
+
+	env := map[string]string{"HOME": home}
+	getenv := func(k string) string { return env[k] }
+	var stdout bytes.Buffer
+
+	require.NoError(t, run([]string{"list"}, getenv, nil, &stdout, &stdout))
+	assert.Equal(t, "Bearer file", auth)
+
+	env["COMPANIES_TOKEN"] = "env"
+	require.NoError(t, run([]string{"list"}, getenv, nil, &stdout, &stdout))
+	assert.Equal(t, "Bearer env", auth)
+
+	require.NoError(t, run([]string{"-token", "flag", "list"}, getenv, nil, &stdout, &stdout))
+	assert.Equal(t, "Bearer flag", auth)
+
+	err := run([]string{"-config", filepath.Join(home, "missing.json"), "list"}, getenv, nil, &stdout, &stdout)
+	assert.Error(t, err)
+}
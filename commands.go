@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/irmatov/companies/companycsv"
+	"github.com/irmatov/companies/service"
+	"github.com/irmatov/companies/types"
+)
+
+// commands are administrative tasks that can be run instead of the server,
+// e.g. `companies import -dry-run companies.csv`.
+var commands = map[string]func(svc *service.Companies, args []string) error{
+	"import":    importCommand,
+	"normalize": normalizeCommand,
+}
+
+func runCommand(storage types.Storage, name string, args []string) error {
+	cmd, ok := commands[name]
+	if !ok {
+		return fmt.Errorf("unknown command %q", name)
+	}
+	return cmd(service.New(storage), args)
+}
+
+func importCommand(svc *service.Companies, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "report the outcome without storing anything")
+	upsert := fs.Bool("upsert", false, "update existing companies with the same name")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: companies import [-dry-run] [-upsert] file.csv")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	rows, err := companycsv.Read(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fs.Arg(0), err)
+	}
+	var companies []types.Company
+	var lines []int
+	var failed int
+	for _, row := range rows {
+		if row.Err != nil {
+			fmt.Fprintf(os.Stderr, "%s:%d: %v\n", fs.Arg(0), row.Line, row.Err)
+			failed++
+			continue
+		}
+		companies = append(companies, row.Company)
+		lines = append(lines, row.Line)
+	}
+	results, err := svc.Import(context.Background(), companies, service.ImportOptions{DryRun: *dryRun, Upsert: *upsert})
+	if err != nil {
+		return err
+	}
+	counts := make(map[service.ImportAction]int)
+	for i, r := range results {
+		counts[r.Action]++
+		if r.Err != nil {
+			fmt.Fprintf(os.Stderr, "%s:%d: %v\n", fs.Arg(0), lines[i], r.Err)
+		}
+	}
+	failed += counts[service.ImportFailed]
+	fmt.Printf("created: %d, updated: %d, unchanged: %d, failed: %d\n",
+		counts[service.ImportCreated], counts[service.ImportUpdated], counts[service.ImportUnchanged], failed)
+	if *dryRun {
+		fmt.Println("dry run, nothing has been stored")
+	}
+	if failed > 0 {
+		return errors.New("some records have not been imported")
+	}
+	return nil
+}
+
+func normalizeCommand(svc *service.Companies, args []string) error {
+	fs := flag.NewFlagSet("normalize", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "report the changes without storing them")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: companies normalize [-dry-run]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	results, err := svc.NormalizeAll(context.Background(), *dryRun)
+	if err != nil {
+		return err
+	}
+	var changed, failed int
+	for _, r := range results {
+		if r.Err != nil {
+			fmt.Fprintf(os.Stderr, "company %d: %v\n", r.Before.Id, r.Err)
+			failed++
+			continue
+		}
+		changed++
+		fmt.Printf("company %d: %+v -> %+v\n", r.Before.Id, companyFields(r.Before), companyFields(r.After))
+	}
+	fmt.Printf("changed: %d, failed: %d\n", changed, failed)
+	if *dryRun {
+		fmt.Println("dry run, nothing has been stored")
+	}
+	if failed > 0 {
+		return errors.New("some companies could not be normalized")
+	}
+	return nil
+}
+
+// companyFields returns the attributes subject to normalization.
+func companyFields(c types.Company) []string {
+	return []string{c.Name, c.Code, c.Country, c.Website, c.Phone}
+}
@@ -0,0 +1,132 @@
+// Package companycsv reads and writes companies in CSV format. The first row
+// is a header naming the columns, the names are the same as the ones used by
+// filter expressions.
+package companycsv
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/irmatov/companies/types"
+)
+
+// Columns lists the column names written by Writer.
+var Columns = []string{"id", "name", "code", "country", "website", "phone", "version"}
+
+// Row is a single record read from a CSV file. Line is the line number where the
+// record starts, Err is set if the record could not be parsed.
+type Row struct {
+	Line    int
+	Company types.Company
+	Err     error
+}
+
+// setters store column values into a company. The id and version columns are
+// accepted so that exported files can be imported back, but they are ignored.
+var setters = map[string]func(c *types.Company, v string){
+	"id":      func(c *types.Company, v string) {},
+	"version": func(c *types.Company, v string) {},
+	"name":    func(c *types.Company, v string) { c.Name = v },
+	"code":    func(c *types.Company, v string) { c.Code = v },
+	"country": func(c *types.Company, v string) { c.Country = v },
+	"website": func(c *types.Company, v string) { c.Website = v },
+	"phone":   func(c *types.Company, v string) { c.Phone = v },
+}
+
+// Read reads all the records from r. Column names in the header are case insensitive,
+// the name column is mandatory. An error is returned if the header is invalid, problems
+// with individual records are reported in the rows.
+func Read(r io.Reader) ([]Row, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, errors.New("missing header")
+	}
+	if err != nil {
+		return nil, err
+	}
+	columns := make([]func(c *types.Company, v string), len(header))
+	seen := make(map[string]bool)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		set, ok := setters[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown column %q", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate column %q", name)
+		}
+		seen[name] = true
+		columns[i] = set
+	}
+	if !seen["name"] {
+		return nil, errors.New("missing name column")
+	}
+
+	var rows []Row
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if perr, ok := err.(*csv.ParseError); ok {
+			// the reader can not reliably continue after syntax errors
+			return append(rows, Row{Line: perr.StartLine, Err: perr.Err}), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		row := Row{}
+		row.Line, _ = cr.FieldPos(0)
+		if len(record) != len(columns) {
+			row.Err = fmt.Errorf("expected %d fields, got %d", len(columns), len(record))
+		} else {
+			for i, v := range record {
+				columns[i](&row.Company, v)
+			}
+		}
+		rows = append(rows, row)
+	}
+}
+
+// Writer writes companies as CSV records, starting with a header.
+type Writer struct {
+	w      *csv.Writer
+	header bool
+}
+
+// NewWriter returns a new Writer that writes to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: csv.NewWriter(w)}
+}
+
+// Write writes a single company, preceded by the header if it is the first one.
+func (w *Writer) Write(c types.Company) error {
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+	return w.w.Write([]string{strconv.Itoa(c.Id), c.Name, c.Code, c.Country, c.Website, c.Phone, strconv.Itoa(c.Version)})
+}
+
+// Flush writes the header if nothing has been written yet and flushes any buffered data.
+func (w *Writer) Flush() error {
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+	w.w.Flush()
+	return w.w.Error()
+}
+
+func (w *Writer) writeHeader() error {
+	if w.header {
+		return nil
+	}
+	w.header = true
+	return w.w.Write(Columns)
+}
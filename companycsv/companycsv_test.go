@@ -0,0 +1,101 @@
+package companycsv
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/irmatov/companies/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []Row
+		wantErr error
+	}{
+		{
+			"empty input",
+			"",
+			nil,
+			errors.New("missing header"),
+		},
+		{
+			"header only",
+			"name,code\n",
+			nil,
+			nil,
+		},
+		{
+			"unknown column",
+			"name,price\n",
+			nil,
+			errors.New(`unknown column "price"`),
+		},
+		{
+			"missing name column",
+			"code,country\n",
+			nil,
+			errors.New("missing name column"),
+		},
+		{
+			"case insensitive columns in any order",
+			"Phone, NAME,country\n+111,First,CY\n",
+			[]Row{{Line: 2, Company: types.Company{Name: "First", Country: "CY", Phone: "+111"}}},
+			nil,
+		},
+		{
+			"wrong number of fields",
+			"name,code\nFirst,FIRST\nSecond\nThird,THIRD\n",
+			[]Row{
+				{Line: 2, Company: types.Company{Name: "First", Code: "FIRST"}},
+				{Line: 3, Err: errors.New("expected 2 fields, got 1")},
+				{Line: 4, Company: types.Company{Name: "Third", Code: "THIRD"}},
+			},
+			nil,
+		},
+		{
+			"quoted multiline field",
+			"name,code\n\"First\nCompany\",FIRST\nSecond,SECOND\n",
+			[]Row{
+				{Line: 2, Company: types.Company{Name: "First\nCompany", Code: "FIRST"}},
+				{Line: 4, Company: types.Company{Name: "Second", Code: "SECOND"}},
+			},
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Read(strings.NewReader(tt.input))
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantErr, err)
+		})
+	}
+}
+
+func TestWriteRead(t *testing.T) {
+	companies := []types.Company{
+		{Id: 1, Name: "First, Inc.", Code: "FIRST", Country: "CY", Website: "https://first.com/", Phone: "+111", Version: 2},
+		{Id: 2, Name: "Second \"Quoted\"", Code: "SECOND", Country: "FR", Version: 1},
+	}
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for _, c := range companies {
+		assert.NoError(t, w.Write(c))
+	}
+	assert.NoError(t, w.Flush())
+	assert.Equal(t, "id,name,code,country,website,phone,version\n"+
+		"1,\"First, Inc.\",FIRST,CY,https://first.com/,+111,2\n"+
+		"2,\"Second \"\"Quoted\"\"\",SECOND,FR,,,1\n", buf.String())
+
+	// identifiers and versions are not imported
+	rows, err := Read(&buf)
+	assert.NoError(t, err)
+	for i := range companies {
+		companies[i].Id, companies[i].Version = 0, 0
+	}
+	assert.Equal(t, []Row{{Line: 2, Company: companies[0]}, {Line: 3, Company: companies[1]}}, rows)
+}
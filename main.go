@@ -3,10 +3,14 @@ package main
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"expvar"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
@@ -15,27 +19,176 @@ import (
 	"github.com/irmatov/companies/server"
 )
 
-const countryLookupTimeout = 5 * time.Second
+const (
+	countryLookupTimeout    = 5 * time.Second
+	countryCacheSize        = 100000
+	countryCacheTTL         = 24 * time.Hour
+	countryCacheNegativeTTL = time.Minute
+	// the lookups are stopped for a while after a number of failures in a row
+	breakerFailureThreshold = 5
+	breakerSuccessThreshold = 2
+	breakerOpenTimeout      = 30 * time.Second
+	lookupAttempts          = 3
+	lookupBackoff           = 100 * time.Millisecond
+	lookupMaxBackoff        = 2 * time.Second
+	// how often the geo-IP database file is checked for changes
+	geoIPReloadInterval = time.Minute
+	defaultDebugAddr    = "localhost:6060"
+)
 
 func main() {
 	db, err := sql.Open("pgx", os.Getenv("DSN"))
 	if err != nil {
 		log.Fatal(err)
 	}
-	srv := server.New(postgres.New(db))
+	if len(os.Args) > 1 {
+		if err := runCommand(postgres.New(db), os.Args[1], os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 	ch := make(chan os.Signal, 1)
 	signal.Notify(ch, os.Interrupt)
 	signal.Notify(ch, syscall.SIGTERM)
-	httpServer := &http.Server{
-		Addr: ":8080",
-		Handler: &middleware.Country{
-			Next:               srv,
-			LookupURLFormat:    "https://ipapi.co/%s/json/",
-			AllowedCountryCode: os.Getenv("ALLOWED_COUNTRY_CODE"),
-			Client:             &http.Client{Timeout: countryLookupTimeout},
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	resolver, err := countryResolver(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	trustedProxies, err := middleware.ParsePrefixes(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		log.Fatalf("TRUSTED_PROXIES: %v", err)
+	}
+	proxies := &middleware.Proxies{Trusted: trustedProxies, Header: os.Getenv("FORWARDED_HEADER")}
+	policy, err := countryPolicy()
+	if err != nil {
+		log.Fatal(err)
+	}
+	// by default the requests are rejected if their country can not be found
+	onFailure := middleware.FailClosed
+	switch mode := os.Getenv("COUNTRY_LOOKUP_FAILURE"); mode {
+	case "", "closed":
+	case "open":
+		onFailure = middleware.FailOpen
+	default:
+		log.Fatalf("COUNTRY_LOOKUP_FAILURE: unknown mode %q, expected open or closed", mode)
+	}
+	country := &middleware.Country{
+		Resolver: resolver,
+		Policy:   policy,
+		Cache:    middleware.NewCountryCache(countryCacheSize, countryCacheTTL, countryCacheNegativeTTL),
+		Breaker: &middleware.Breaker{
+			FailureThreshold: breakerFailureThreshold,
+			SuccessThreshold: breakerSuccessThreshold,
+			OpenTimeout:      breakerOpenTimeout,
 		},
+		Retry: middleware.RetryPolicy{
+			Attempts:   lookupAttempts,
+			Backoff:    lookupBackoff,
+			MaxBackoff: lookupMaxBackoff,
+		},
+		Proxies:   proxies,
+		OnFailure: onFailure,
+		// e.g. X-Client-Country to see the country the requests are checked against
+		CountryHeader: os.Getenv("COUNTRY_DEBUG_HEADER"),
+	}
+	srv := server.NewWithOptions(postgres.New(db), server.Options{Restrict: country.Wrap})
+	expvar.Publish("country_lookup", expvar.Func(func() interface{} { return country.Stats() }))
+	mux := http.NewServeMux()
+	mux.Handle("/healthz", health(map[string]func() error{"country_lookup": country.Healthy}))
+	mux.Handle("/", proxies.Wrap(srv))
+	httpServer := &http.Server{
+		Addr:    ":8080",
+		Handler: mux,
+	}
+	// the counters are for the operators only, so they are served on another address
+	debugAddr := os.Getenv("DEBUG_ADDR")
+	if debugAddr == "" {
+		debugAddr = defaultDebugAddr
+	}
+	debugMux := http.NewServeMux()
+	debugMux.Handle("/debug/vars", expvar.Handler())
+	debugServer := &http.Server{
+		Addr:    debugAddr,
+		Handler: debugMux,
 	}
 	go httpServer.ListenAndServe()
+	go debugServer.ListenAndServe()
 	<-ch
 	httpServer.Shutdown(context.Background())
+	debugServer.Shutdown(context.Background())
+}
+
+// countryResolver returns the local geo-IP database resolver if GEOIP_DATABASE is set,
+// the web services otherwise. ip-api.com is only asked if COUNTRY_LOOKUP_PLAINTEXT is
+// set, its free service is not available over HTTPS.
+func countryResolver(ctx context.Context) (middleware.CountryResolver, error) {
+	if path := os.Getenv("GEOIP_DATABASE"); path != "" {
+		r, err := middleware.OpenMMDB(path)
+		if err != nil {
+			return nil, err
+		}
+		go r.Watch(ctx, geoIPReloadInterval)
+		return r, nil
+	}
+	lookupClient := &http.Client{Timeout: countryLookupTimeout}
+	resolver := middleware.ChainResolver{middleware.NewIPAPICo(lookupClient)}
+	if v := os.Getenv("COUNTRY_LOOKUP_PLAINTEXT"); v != "" {
+		plaintext, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("COUNTRY_LOOKUP_PLAINTEXT: %w", err)
+		}
+		if plaintext {
+			resolver = append(resolver, middleware.NewIPAPICom(lookupClient))
+		}
+	}
+	if token := os.Getenv("IPINFO_TOKEN"); token != "" {
+		resolver = append(resolver, middleware.NewIPInfo(lookupClient, token))
+	}
+	return resolver, nil
+}
+
+// countryPolicy reads the access policy from the environment, the lists are comma
+// separated. Without ALLOWED_COUNTRY_CODE (or "*" for any country) only the allowed
+// networks and address classes may create and delete companies.
+func countryPolicy() (middleware.CountryPolicy, error) {
+	var policy middleware.CountryPolicy
+	var err error
+	if policy.AllowCountries, err = middleware.ParseCountryCodes(os.Getenv("ALLOWED_COUNTRY_CODE")); err != nil {
+		return policy, fmt.Errorf("ALLOWED_COUNTRY_CODE: %w", err)
+	}
+	if policy.DenyCountries, err = middleware.ParseCountryCodes(os.Getenv("DENIED_COUNTRY_CODE")); err != nil {
+		return policy, fmt.Errorf("DENIED_COUNTRY_CODE: %w", err)
+	}
+	if policy.AllowNetworks, err = middleware.ParsePrefixes(os.Getenv("ALLOWED_NETWORKS")); err != nil {
+		return policy, fmt.Errorf("ALLOWED_NETWORKS: %w", err)
+	}
+	if policy.DenyNetworks, err = middleware.ParsePrefixes(os.Getenv("DENIED_NETWORKS")); err != nil {
+		return policy, fmt.Errorf("DENIED_NETWORKS: %w", err)
+	}
+	// e.g. "loopback,private" for local development and internal callers
+	if policy.AllowAddressClasses, err = middleware.ParseAddressClasses(os.Getenv("ALLOWED_ADDRESS_CLASSES")); err != nil {
+		return policy, fmt.Errorf("ALLOWED_ADDRESS_CLASSES: %w", err)
+	}
+	return policy, nil
+}
+
+// health reports if the service is able to serve requests. The checks are about the
+// dependencies the service keeps working without, e.g. the country lookups failing
+// only affect the restricted routes, so the failing ones are listed in the response
+// as degraded but the status is always 200.
+func health(checks map[string]func() error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		result := map[string]string{"status": "ok"}
+		for name, check := range checks {
+			result[name] = "ok"
+			if err := check(); err != nil {
+				result[name] = err.Error()
+				result["status"] = "degraded"
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	})
 }
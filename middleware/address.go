@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// AddressClass is a kind of special-purpose addresses (RFC 6890), which are not
+// located in any country and so are never looked up.
+type AddressClass int
+
+const (
+	// PublicAddress is a globally reachable address, not a special-purpose one.
+	PublicAddress AddressClass = iota
+	// LoopbackAddress is 127.0.0.0/8 or ::1.
+	LoopbackAddress
+	// PrivateAddress is in RFC 1918 networks, 100.64.0.0/10 shared by carrier-grade
+	// NATs or fc00::/7 unique local IPv6 addresses.
+	PrivateAddress
+	// LinkLocalAddress is in 169.254.0.0/16 or fe80::/10, including multicast ones.
+	LinkLocalAddress
+	// ReservedAddress is any other special-purpose address, e.g. unspecified,
+	// multicast or documentation one.
+	ReservedAddress
+)
+
+var addressClassNames = map[AddressClass]string{
+	PublicAddress:    "public",
+	LoopbackAddress:  "loopback",
+	PrivateAddress:   "private",
+	LinkLocalAddress: "link-local",
+	ReservedAddress:  "reserved",
+}
+
+func (c AddressClass) String() string {
+	if name, ok := addressClassNames[c]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+var (
+	sharedNetwork    = netip.MustParsePrefix("100.64.0.0/10")
+	reservedNetworks = []netip.Prefix{
+		netip.MustParsePrefix("0.0.0.0/8"),
+		netip.MustParsePrefix("192.0.0.0/24"),
+		netip.MustParsePrefix("192.0.2.0/24"),
+		netip.MustParsePrefix("198.18.0.0/15"),
+		netip.MustParsePrefix("198.51.100.0/24"),
+		netip.MustParsePrefix("203.0.113.0/24"),
+		netip.MustParsePrefix("240.0.0.0/4"),
+		netip.MustParsePrefix("100::/64"),
+		netip.MustParsePrefix("2001:db8::/32"),
+	}
+)
+
+// ClassifyAddress returns the class of the address, IPv4-mapped IPv6 addresses are
+// classified as IPv4 ones and zones are ignored.
+func ClassifyAddress(addr netip.Addr) AddressClass {
+	addr = addr.Unmap().WithZone("")
+	switch {
+	case addr.IsLoopback():
+		return LoopbackAddress
+	case addr.IsPrivate() || sharedNetwork.Contains(addr):
+		return PrivateAddress
+	case addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast():
+		return LinkLocalAddress
+	case !addr.IsValid() || addr.IsUnspecified() || addr.IsMulticast() || containsAddr(reservedNetworks, addr):
+		return ReservedAddress
+	}
+	return PublicAddress
+}
+
+// ParseAddressClasses parses a comma separated list of address class names.
+func ParseAddressClasses(s string) ([]AddressClass, error) {
+	var classes []AddressClass
+	for _, v := range strings.Split(s, ",") {
+		v = strings.ToLower(strings.TrimSpace(v))
+		if v == "" {
+			continue
+		}
+		class, ok := parseAddressClass(v)
+		if !ok {
+			return nil, fmt.Errorf("unknown address class %q", v)
+		}
+		classes = append(classes, class)
+	}
+	return classes, nil
+}
+
+func parseAddressClass(name string) (AddressClass, bool) {
+	for class, n := range addressClassNames {
+		if n == name {
+			return class, true
+		}
+	}
+	return 0, false
+}
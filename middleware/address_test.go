@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifyAddress(t *testing.T) {
+	for addr, want := range map[string]AddressClass{
+		"1.1.1.1":            PublicAddress,
+		"2a00:1450::1":       PublicAddress,
+		"::ffff:8.8.8.8":     PublicAddress,
+		"127.0.0.1":          LoopbackAddress,
+		"127.1.2.3":          LoopbackAddress,
+		"::1":                LoopbackAddress,
+		"::ffff:127.0.0.1":   LoopbackAddress,
+		"10.1.2.3":           PrivateAddress,
+		"172.16.0.1":         PrivateAddress,
+		"172.32.0.1":         PublicAddress,
+		"192.168.1.1":        PrivateAddress,
+		"::ffff:192.168.1.1": PrivateAddress,
+		"100.64.0.1":         PrivateAddress,
+		"fd12:3456::1":       PrivateAddress,
+		"169.254.1.1":        LinkLocalAddress,
+		"fe80::1":            LinkLocalAddress,
+		"fe80::1%eth0":       LinkLocalAddress,
+		"ff02::1":            LinkLocalAddress,
+		"0.0.0.0":            ReservedAddress,
+		"::":                 ReservedAddress,
+		"239.1.1.1":          ReservedAddress,
+		"ff0e::1":            ReservedAddress,
+		"192.0.2.1":          ReservedAddress,
+		"2001:db8::1":        ReservedAddress,
+		"255.255.255.255":    ReservedAddress,
+		"198.18.0.1":         ReservedAddress,
+	} {
+		assert.Equal(t, want, ClassifyAddress(netip.MustParseAddr(addr)), addr)
+	}
+	assert.Equal(t, ReservedAddress, ClassifyAddress(netip.Addr{}))
+}
+
+func TestParseAddressClasses(t *testing.T) {
+	classes, err := ParseAddressClasses("loopback, Private,,link-local")
+	require.NoError(t, err)
+	assert.Equal(t, []AddressClass{LoopbackAddress, PrivateAddress, LinkLocalAddress}, classes)
+	assert.Equal(t, "link-local", LinkLocalAddress.String())
+
+	_, err = ParseAddressClasses("loopback,lan")
+	assert.Error(t, err)
+}
@@ -0,0 +1,162 @@
+package middleware
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrBreakerOpen is returned instead of calling a service the breaker considers failing.
+var ErrBreakerOpen = errors.New("circuit breaker is open")
+
+// BreakerState is a state of a circuit breaker.
+type BreakerState int
+
+const (
+	// BreakerClosed lets all the calls through.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen rejects all the calls.
+	BreakerOpen
+	// BreakerHalfOpen lets trial calls through one at a time.
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// Breaker is a circuit breaker. It opens after FailureThreshold consecutive failures
+// and rejects the calls for OpenTimeout, then lets trial calls through one at a time.
+// After SuccessThreshold consecutive successful trials it closes, a failed trial
+// opens it again.
+type Breaker struct {
+	FailureThreshold int
+	SuccessThreshold int
+	OpenTimeout      time.Duration
+
+	mutex     sync.Mutex
+	state     BreakerState
+	failures  int
+	successes int
+	openedAt  time.Time
+	trial     bool // a trial call is in progress
+	opens     atomic.Int64
+	rejected  atomic.Int64
+	now       func() time.Time
+}
+
+// BreakerStats reports the breaker state and counters.
+type BreakerStats struct {
+	State    string
+	Opens    int64
+	Rejected int64
+}
+
+// Do calls fn unless the breaker is open, in which case ErrBreakerOpen is returned.
+// An error returned by fn counts as a failure.
+func (b *Breaker) Do(fn func() error) error {
+	if !b.allow() {
+		b.rejected.Add(1)
+		return ErrBreakerOpen
+	}
+	err := fn()
+	b.done(err != nil)
+	return err
+}
+
+// State returns the current state of the breaker.
+func (b *Breaker) State() BreakerState {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.update()
+	return b.state
+}
+
+// openFor returns how long the breaker stays open, zero if it is not open.
+func (b *Breaker) openFor() time.Duration {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.update()
+	if b.state != BreakerOpen {
+		return 0
+	}
+	return b.OpenTimeout - b.clock().Sub(b.openedAt)
+}
+
+// Stats returns the breaker state and counters.
+func (b *Breaker) Stats() BreakerStats {
+	return BreakerStats{State: b.State().String(), Opens: b.opens.Load(), Rejected: b.rejected.Load()}
+}
+
+func (b *Breaker) allow() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.update()
+	switch b.state {
+	case BreakerOpen:
+		return false
+	case BreakerHalfOpen:
+		if b.trial {
+			return false
+		}
+		b.trial = true
+	}
+	return true
+}
+
+func (b *Breaker) done(failed bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.state == BreakerHalfOpen {
+		b.trial = false
+		if failed {
+			b.open()
+			return
+		}
+		b.successes++
+		if b.successes >= b.SuccessThreshold {
+			b.state = BreakerClosed
+			b.failures = 0
+		}
+		return
+	}
+	if !failed {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == BreakerClosed && b.failures >= b.FailureThreshold {
+		b.open()
+	}
+}
+
+func (b *Breaker) open() {
+	b.state = BreakerOpen
+	b.openedAt = b.clock()
+	b.opens.Add(1)
+}
+
+// update moves an open breaker to half-open once OpenTimeout has passed.
+func (b *Breaker) update() {
+	if b.state == BreakerOpen && b.clock().Sub(b.openedAt) >= b.OpenTimeout {
+		b.state = BreakerHalfOpen
+		b.successes = 0
+		b.trial = false
+	}
+}
+
+func (b *Breaker) clock() time.Time {
+	if b.now == nil {
+		return time.Now()
+	}
+	return b.now()
+}
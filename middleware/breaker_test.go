@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBreaker(t *testing.T) {
+	now := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+	b := &Breaker{FailureThreshold: 2, SuccessThreshold: 2, OpenTimeout: time.Minute}
+	b.now = func() time.Time { return now }
+	errFailed := errors.New("failed")
+	fail := func() error { return errFailed }
+	succeed := func() error { return nil }
+
+	assert.Equal(t, errFailed, b.Do(fail))
+	assert.NoError(t, b.Do(succeed))
+	assert.Equal(t, errFailed, b.Do(fail))
+	assert.Equal(t, BreakerClosed, b.State(), "failures must be consecutive")
+	assert.Equal(t, errFailed, b.Do(fail))
+	assert.Equal(t, BreakerOpen, b.State())
+
+	called := false
+	assert.Equal(t, ErrBreakerOpen, b.Do(func() error { called = true; return nil }))
+	assert.False(t, called)
+
+	now = now.Add(time.Minute)
+	assert.Equal(t, BreakerHalfOpen, b.State())
+	assert.Equal(t, errFailed, b.Do(fail))
+	assert.Equal(t, BreakerOpen, b.State(), "failed trial opens the breaker again")
+
+	now = now.Add(time.Minute)
+	assert.NoError(t, b.Do(func() error {
+		// only one trial at a time
+		assert.Equal(t, ErrBreakerOpen, b.Do(succeed))
+		return nil
+	}))
+	assert.Equal(t, BreakerHalfOpen, b.State())
+	assert.NoError(t, b.Do(succeed))
+	assert.Equal(t, BreakerClosed, b.State())
+
+	assert.Equal(t, BreakerStats{State: "closed", Opens: 2, Rejected: 2}, b.Stats())
+}
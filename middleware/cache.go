@@ -0,0 +1,145 @@
+package middleware
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CountryCache keeps the results of country lookups by IP address. Successful lookups
+// are kept for TTL, failed ones for NegativeTTL, so a failing lookup service is not
+// asked about the same address on every request. The least recently used entries are
+// evicted once there are Size of them. Concurrent lookups of the same address are
+// made only once. Failures which say nothing about the address, i.e. timeouts,
+// cancellations and lookups rejected by the breaker, are not kept.
+type CountryCache struct {
+	Size        int
+	TTL         time.Duration
+	NegativeTTL time.Duration
+
+	mutex   sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List // of *cacheEntry, the most recently used first
+	calls   map[string]*lookupCall
+	hits    atomic.Int64
+	misses  atomic.Int64
+	now     func() time.Time
+}
+
+// CacheStats reports the cache usage.
+type CacheStats struct {
+	Hits    int64
+	Misses  int64
+	Entries int
+}
+
+type cacheEntry struct {
+	ip      string
+	country string
+	err     error
+	expires time.Time
+}
+
+// lookupCall is a lookup in progress, the callers asking for the same address wait for it.
+type lookupCall struct {
+	done    chan struct{}
+	country string
+	err     error
+}
+
+// NewCountryCache creates a cache of at most size entries.
+func NewCountryCache(size int, ttl, negativeTTL time.Duration) *CountryCache {
+	return &CountryCache{Size: size, TTL: ttl, NegativeTTL: negativeTTL}
+}
+
+// Lookup returns the cached country of the IP address or calls lookup to find it.
+// The lookup is shared by all the callers asking for the address meanwhile, so it
+// runs on its own and must not depend on the context of any of them; a caller stops
+// waiting for it when ctx is done.
+func (c *CountryCache) Lookup(ctx context.Context, ip string, lookup func(ip string) (string, error)) (string, error) {
+	c.mutex.Lock()
+	c.init()
+	now := c.now()
+	if e, ok := c.entries[ip]; ok {
+		entry := e.Value.(*cacheEntry)
+		if now.Before(entry.expires) {
+			c.lru.MoveToFront(e)
+			c.mutex.Unlock()
+			c.hits.Add(1)
+			return entry.country, entry.err
+		}
+		c.remove(e)
+	}
+	c.misses.Add(1)
+	call, ok := c.calls[ip]
+	if !ok {
+		call = &lookupCall{done: make(chan struct{})}
+		c.calls[ip] = call
+		go c.lookup(ip, call, lookup)
+	}
+	c.mutex.Unlock()
+	select {
+	case <-call.done:
+		return call.country, call.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+func (c *CountryCache) lookup(ip string, call *lookupCall, lookup func(ip string) (string, error)) {
+	country, err := lookup(ip)
+	c.mutex.Lock()
+	call.country, call.err = country, err
+	delete(c.calls, ip)
+	if cacheable(err) {
+		c.add(ip, country, err)
+	}
+	c.mutex.Unlock()
+	close(call.done)
+}
+
+// cacheable tells if the lookup result may be reused for later requests from the
+// address.
+func cacheable(err error) bool {
+	return err != ErrBreakerOpen && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
+
+// Stats returns the cache usage counters.
+func (c *CountryCache) Stats() CacheStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return CacheStats{Hits: c.hits.Load(), Misses: c.misses.Load(), Entries: len(c.entries)}
+}
+
+func (c *CountryCache) init() {
+	if c.entries == nil {
+		c.entries = make(map[string]*list.Element)
+		c.lru = list.New()
+		c.calls = make(map[string]*lookupCall)
+	}
+	if c.now == nil {
+		c.now = time.Now
+	}
+}
+
+func (c *CountryCache) add(ip, country string, err error) {
+	ttl := c.TTL
+	if err != nil {
+		ttl = c.NegativeTTL
+	}
+	if ttl <= 0 || c.Size <= 0 {
+		return
+	}
+	c.entries[ip] = c.lru.PushFront(&cacheEntry{ip: ip, country: country, err: err, expires: c.now().Add(ttl)})
+	for c.lru.Len() > c.Size {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *CountryCache) remove(e *list.Element) {
+	c.lru.Remove(e)
+	delete(c.entries, e.Value.(*cacheEntry).ip)
+}
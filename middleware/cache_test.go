@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCountryCache(t *testing.T) {
+	now := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+	c := NewCountryCache(2, time.Hour, time.Minute)
+	c.now = func() time.Time { return now }
+	var calls int
+	errLookup := errors.New("lookup failed")
+	lookup := func(ip string) (string, error) {
+		calls++
+		if ip == "0.0.0.0" {
+			return "", errLookup
+		}
+		return "CY", nil
+	}
+
+	country, err := c.Lookup(ctx, "1.1.1.1", lookup)
+	require.NoError(t, err)
+	assert.Equal(t, "CY", country)
+	country, err = c.Lookup(ctx, "1.1.1.1", lookup)
+	require.NoError(t, err)
+	assert.Equal(t, "CY", country)
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, CacheStats{Hits: 1, Misses: 1, Entries: 1}, c.Stats())
+
+	t.Run("negative ttl", func(t *testing.T) {
+		_, err := c.Lookup(ctx, "0.0.0.0", lookup)
+		assert.Equal(t, errLookup, err)
+		_, err = c.Lookup(ctx, "0.0.0.0", lookup)
+		assert.Equal(t, errLookup, err)
+		assert.Equal(t, 2, calls)
+		now = now.Add(2 * time.Minute)
+		_, err = c.Lookup(ctx, "0.0.0.0", lookup)
+		assert.Equal(t, errLookup, err)
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("size", func(t *testing.T) {
+		// 0.0.0.0 is the least recently used one
+		c.Lookup(ctx, "1.1.1.1", lookup)
+		c.Lookup(ctx, "2.2.2.2", lookup)
+		assert.Equal(t, 2, c.Stats().Entries)
+		calls = 0
+		c.Lookup(ctx, "1.1.1.1", lookup)
+		c.Lookup(ctx, "2.2.2.2", lookup)
+		assert.Equal(t, 0, calls)
+		c.Lookup(ctx, "0.0.0.0", lookup)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("ttl", func(t *testing.T) {
+		calls = 0
+		now = now.Add(2 * time.Hour)
+		c.Lookup(ctx, "2.2.2.2", lookup)
+		assert.Equal(t, 1, calls)
+	})
+}
+
+func TestCountryCacheConcurrentLookups(t *testing.T) {
+	ctx := context.Background()
+	c := NewCountryCache(10, time.Hour, time.Minute)
+	var calls atomic.Int64
+	release := make(chan struct{})
+	lookup := func(ip string) (string, error) {
+		calls.Add(1)
+		<-release
+		return "CY", nil
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			country, err := c.Lookup(ctx, "1.1.1.1", lookup)
+			assert.NoError(t, err)
+			assert.Equal(t, "CY", country)
+		}()
+	}
+	// wait until every goroutine has either started the lookup or joined it
+	require.Eventually(t, func() bool { return c.Stats().Misses == 10 }, time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int64(1), calls.Load())
+}
+
+func TestCountryCacheCanceledCaller(t *testing.T) {
+	c := NewCountryCache(10, time.Hour, time.Minute)
+	release := make(chan struct{})
+	var calls atomic.Int64
+	lookup := func(ip string) (string, error) {
+		calls.Add(1)
+		<-release
+		return "CY", nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := c.Lookup(ctx, "1.1.1.1", lookup)
+	assert.Equal(t, context.Canceled, err)
+
+	// the lookup goes on for the other callers and is cached
+	close(release)
+	country, err := c.Lookup(context.Background(), "1.1.1.1", lookup)
+	require.NoError(t, err)
+	assert.Equal(t, "CY", country)
+	country, err = c.Lookup(context.Background(), "1.1.1.1", lookup)
+	require.NoError(t, err)
+	assert.Equal(t, "CY", country)
+	assert.Equal(t, int64(1), calls.Load())
+}
+
+func TestCountryCacheTransientFailures(t *testing.T) {
+	ctx := context.Background()
+	for _, failure := range []error{ErrBreakerOpen, context.DeadlineExceeded, context.Canceled, fmt.Errorf("lookup: %w", context.DeadlineExceeded)} {
+		c := NewCountryCache(10, time.Hour, time.Minute)
+		_, err := c.Lookup(ctx, "1.1.1.1", func(ip string) (string, error) { return "", failure })
+		assert.Equal(t, failure, err)
+		country, err := c.Lookup(ctx, "1.1.1.1", func(ip string) (string, error) { return "CY", nil })
+		require.NoError(t, err, "%v must not be cached", failure)
+		assert.Equal(t, "CY", country)
+	}
+}
@@ -1,59 +1,226 @@
 package middleware
 
 import (
-	"encoding/json"
-	"errors"
-	"fmt"
-	"net"
+	"context"
+	"log"
 	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/irmatov/companies/problem"
+	"github.com/irmatov/companies/types"
 )
 
-// Country is a middleware that checks if the request is coming from a specific country.
-// Cacheing of requests is needed, and a circuit breaker, but..
+// FailureMode tells what happens to the requests when the country of the client can
+// not be found.
+type FailureMode int
+
+const (
+	// FailClosed rejects the requests with 503 status and Retry-After header.
+	FailClosed FailureMode = iota
+	// FailOpen lets the requests through, each of them is logged for audit.
+	FailOpen
+)
+
+func (f FailureMode) String() string {
+	switch f {
+	case FailClosed:
+		return "closed"
+	case FailOpen:
+		return "open"
+	}
+	return "unknown"
+}
+
+// defaultLookupTimeout limits the lookups shared by the requests via the cache.
+const defaultLookupTimeout = 15 * time.Second
+
+// defaultFailureRetryAfter is suggested to the clients rejected because of a failed
+// lookup if there is no better estimate.
+const defaultFailureRetryAfter = 5 * time.Second
+
+// Country is a middleware that checks if the request is coming from an allowed country.
 type Country struct {
-	Next               http.Handler
-	LookupURLFormat    string
-	AllowedCountryCode string
-	Client             *http.Client
+	// Next handles the allowed requests when Country is used as a handler itself.
+	Next http.Handler
+	// Resolver finds the country of the client. If it is nil, ipapi.co compatible
+	// service at LookupURLFormat is asked using Client.
+	Resolver        CountryResolver
+	LookupURLFormat string
+	Client          *http.Client
+	// Policy decides which clients are allowed.
+	Policy CountryPolicy
+	// Cache keeps the lookup results, every request is looked up if it is nil.
+	Cache *CountryCache
+	// LookupTimeout limits a cached lookup including its retries, as it is not bound
+	// to any request; defaultLookupTimeout if zero.
+	LookupTimeout time.Duration
+	// Breaker stops the lookups while the service is failing, it is not used if nil.
+	Breaker *Breaker
+	Retry   RetryPolicy
+	// Proxies finds the client address behind the proxies, RemoteAddr is used if it
+	// is nil.
+	Proxies *Proxies
+	// OnFailure tells what happens to the requests when the lookup fails.
+	OnFailure FailureMode
+	// CountryHeader, if set, is the name of a response header the country of the
+	// client is echoed in, e.g. X-Client-Country for debugging.
+	CountryHeader string
+	// FailureRetryAfter is suggested to the rejected clients unless the service or the
+	// breaker tell when the lookups may succeed again, defaultFailureRetryAfter if zero.
+	FailureRetryAfter time.Duration
+
+	retries  atomic.Int64
+	failures atomic.Int64
 }
 
 func (m *Country) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	ipport := r.RemoteAddr
-	host, _, err := net.SplitHostPort(ipport)
+	m.serve(w, r, m.Next)
+}
+
+// Wrap returns a handler checking the requests before passing them to next, so one
+// Country can guard several handlers, sharing its cache and breaker.
+func (m *Country) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.serve(w, r, next)
+	})
+}
+
+func (m *Country) serve(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	addr, err := m.Proxies.ClientIP(r)
 	if err != nil {
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		log.Printf("client address of %s: %v", r.RemoteAddr, err)
+		problem.New(http.StatusInternalServerError, problem.CodeInternal, "").Write(w, r)
 		return
 	}
-	countryCode, err := m.lookupCountry(host)
+	client := types.Client{IP: addr}
+	allowed, err := m.Policy.Allowed(addr, func() (string, error) {
+		country, err := m.country(r.Context(), addr.String())
+		if err == nil {
+			client.Country = country
+		}
+		return country, err
+	})
+	r = r.WithContext(types.WithClient(r.Context(), client))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		m.failures.Add(1)
+		if m.OnFailure == FailOpen {
+			log.Printf("country lookup for %s failed, letting %s %s through: %v", addr, r.Method, r.URL.Path, err)
+			next.ServeHTTP(w, r)
+			return
+		}
+		log.Printf("country lookup for %s: %v", addr, err)
+		retryAfter := (m.retryAfter(err) + time.Second - 1) / time.Second
+		w.Header().Set("Retry-After", strconv.FormatInt(int64(retryAfter), 10))
+		problem.New(http.StatusServiceUnavailable, problem.CodeUnavailable, "your location can not be verified at the moment").Write(w, r)
 		return
 	}
-	if countryCode != m.AllowedCountryCode {
-		http.Error(w, "forbidden", http.StatusForbidden)
+	if m.CountryHeader != "" && client.Country != "" {
+		w.Header().Set(m.CountryHeader, client.Country)
+	}
+	if !allowed {
+		problem.New(http.StatusForbidden, problem.CodeForbidden, "requests from your location are not allowed").Write(w, r)
 		return
 	}
-	m.Next.ServeHTTP(w, r)
+	next.ServeHTTP(w, r)
 }
 
-func (m *Country) lookupCountry(ip string) (string, error) {
-	req, err := http.NewRequest("GET", fmt.Sprintf(m.LookupURLFormat, ip), nil)
-	if err != nil {
-		return "", err
+// country returns the country of the IP address, from the cache if there is one.
+func (m *Country) country(ctx context.Context, ip string) (string, error) {
+	if m.Cache == nil {
+		return m.lookupCountry(ctx, ip)
 	}
-	resp, err := m.Client.Do(req)
-	if err != nil {
-		return "", nil
+	return m.Cache.Lookup(ctx, ip, func(ip string) (string, error) {
+		// the lookup is shared by the requests from the address, it must not be
+		// canceled with the one which started it
+		ctx, cancel := context.WithTimeout(context.Background(), m.lookupTimeout())
+		defer cancel()
+		return m.lookupCountry(ctx, ip)
+	})
+}
+
+func (m *Country) lookupTimeout() time.Duration {
+	if m.LookupTimeout > 0 {
+		return m.LookupTimeout
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return "", errors.New("internal server error")
+	return defaultLookupTimeout
+}
+
+// lookupCountry asks the resolver about the IP address. Failures of the service are
+// retried according to the policy while the breaker lets the calls through.
+func (m *Country) lookupCountry(ctx context.Context, ip string) (string, error) {
+	var country string
+	err := m.Retry.retry(ctx, func() error {
+		var err error
+		fetch := func() error {
+			country, err = m.resolver().Country(ctx, ip)
+			// only failures of the service itself count for the breaker
+			if err != nil && isServiceFailure(err) {
+				return err
+			}
+			return nil
+		}
+		if m.Breaker == nil {
+			fetch()
+		} else if m.Breaker.Do(fetch) == ErrBreakerOpen {
+			return ErrBreakerOpen
+		}
+		return err
+	}, func() { m.retries.Add(1) })
+	return country, err
+}
+
+// retryAfter estimates when the lookup failed with the error may succeed.
+func (m *Country) retryAfter(err error) time.Duration {
+	var d time.Duration
+	if e, ok := err.(*statusError); ok {
+		d = e.retryAfter
+	} else if err == ErrBreakerOpen && m.Breaker != nil {
+		d = m.Breaker.openFor()
 	}
-	var data struct {
-		CountryCode string `json:"country_code"`
+	if d <= 0 {
+		d = m.FailureRetryAfter
+	}
+	if d <= 0 {
+		d = defaultFailureRetryAfter
+	}
+	return d
+}
+
+func (m *Country) resolver() CountryResolver {
+	if m.Resolver != nil {
+		return m.Resolver
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
-		return "", err
+	return &HTTPResolver{URLFormat: m.LookupURLFormat, Client: m.Client, Decode: DecodeIPAPICo}
+}
+
+// CountryStats reports the country lookups.
+type CountryStats struct {
+	Retries  int64
+	Failures int64
+	Cache    *CacheStats   `json:",omitempty"`
+	Breaker  *BreakerStats `json:",omitempty"`
+}
+
+// Stats returns the lookup counters, e.g. to be published with expvar.
+func (m *Country) Stats() CountryStats {
+	stats := CountryStats{Retries: m.retries.Load(), Failures: m.failures.Load()}
+	if m.Cache != nil {
+		cache := m.Cache.Stats()
+		stats.Cache = &cache
+	}
+	if m.Breaker != nil {
+		breaker := m.Breaker.Stats()
+		stats.Breaker = &breaker
+	}
+	return stats
+}
+
+// Healthy returns an error if the lookups are known to fail at the moment.
+func (m *Country) Healthy() error {
+	if m.Breaker != nil && m.Breaker.State() == BreakerOpen {
+		return ErrBreakerOpen
 	}
-	return data.CountryCode, nil
+	return nil
 }
@@ -1,12 +1,21 @@
 package middleware
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/irmatov/companies/problem"
+	"github.com/irmatov/companies/types"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type lookupResult struct {
@@ -28,10 +37,10 @@ func TestCountry(t *testing.T) {
 	}))
 	defer server.Close()
 	auth := &Country{
-		Next:               protected,
-		LookupURLFormat:    server.URL + "/%s",
-		AllowedCountryCode: "US",
-		Client:             &http.Client{},
+		Next:            protected,
+		LookupURLFormat: server.URL + "/%s",
+		Policy:          CountryPolicy{AllowCountries: []string{"US"}},
+		Client:          &http.Client{},
 	}
 
 	t.Run("allowed", func(t *testing.T) {
@@ -51,7 +60,10 @@ func TestCountry(t *testing.T) {
 		w := httptest.NewRecorder()
 		auth.ServeHTTP(w, req)
 		assert.Equal(t, http.StatusForbidden, w.Code)
-		assert.Equal(t, "forbidden\n", w.Body.String())
+		assert.Equal(t, problem.ContentType, w.Result().Header.Get("Content-Type"))
+		var p problem.Problem
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+		assert.Equal(t, problem.CodeForbidden, p.Code)
 	})
 
 	t.Run("lookup failure", func(t *testing.T) {
@@ -60,7 +72,123 @@ func TestCountry(t *testing.T) {
 		req.RemoteAddr = "3.3.3.3:1234"
 		w := httptest.NewRecorder()
 		auth.ServeHTTP(w, req)
-		assert.Equal(t, http.StatusInternalServerError, w.Code)
-		assert.Equal(t, "internal server error\n", w.Body.String())
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, "5", w.Result().Header.Get("Retry-After"))
+		var p problem.Problem
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+		assert.Equal(t, problem.CodeUnavailable, p.Code)
+		assert.NotContains(t, p.Detail, "500", "lookup errors must not be leaked")
 	})
+
+	t.Run("fail open", func(t *testing.T) {
+		open := &Country{
+			Next:            protected,
+			LookupURLFormat: server.URL + "/%s",
+			Policy:          CountryPolicy{AllowCountries: []string{"US"}},
+			Client:          &http.Client{},
+			OnFailure:       FailOpen,
+		}
+		lookupResults <- lookupResult{http.StatusInternalServerError, "CN"}
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "4.4.4.4:1234"
+		w := httptest.NewRecorder()
+		open.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, int64(1), open.Stats().Failures)
+	})
+}
+
+func TestCountryRetryAfter(t *testing.T) {
+	now := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+	breaker := &Breaker{FailureThreshold: 1, SuccessThreshold: 1, OpenTimeout: time.Minute}
+	breaker.now = func() time.Time { return now }
+	m := &Country{Breaker: breaker, FailureRetryAfter: 10 * time.Second}
+
+	assert.Equal(t, 10*time.Second, m.retryAfter(errors.New("failed")))
+	assert.Equal(t, 3*time.Second, m.retryAfter(&statusError{http.StatusTooManyRequests, 3 * time.Second}))
+	assert.Equal(t, 10*time.Second, m.retryAfter(&statusError{http.StatusBadGateway, 0}))
+
+	breaker.Do(func() error { return errors.New("failed") })
+	now = now.Add(20 * time.Second)
+	assert.Equal(t, 40*time.Second, m.retryAfter(ErrBreakerOpen))
+
+	m.FailureRetryAfter = 0
+	assert.Equal(t, defaultFailureRetryAfter, m.retryAfter(errors.New("failed")))
+}
+
+// countryResolver resolves all the addresses to the same country.
+type countryResolver string
+
+func (c countryResolver) Country(ctx context.Context, ip string) (string, error) {
+	return string(c), nil
+}
+
+func TestCountryClient(t *testing.T) {
+	var client types.Client
+	var stored bool
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client, stored = types.ClientFromContext(r.Context())
+	})
+	m := &Country{
+		Resolver:      countryResolver("CY"),
+		Policy:        CountryPolicy{AllowCountries: []string{"CY"}, AllowNetworks: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}},
+		Proxies:       &Proxies{Trusted: []netip.Prefix{netip.MustParsePrefix("10.0.0.1/32")}},
+		CountryHeader: "X-Client-Country",
+	}
+	serve := func(h http.Handler, remoteAddr, forwardedFor string) *httptest.ResponseRecorder {
+		client, stored = types.Client{}, false
+		req := httptest.NewRequest("POST", "/", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve(m.Wrap(next), "10.0.0.1:1234", "5.5.5.5")
+	assert.True(t, stored)
+	assert.Equal(t, types.Client{IP: netip.MustParseAddr("5.5.5.5"), Country: "CY"}, client)
+	assert.Equal(t, "CY", w.Result().Header.Get("X-Client-Country"))
+
+	w = serve(m.Wrap(next), "10.0.0.2:1234", "")
+	assert.True(t, stored)
+	assert.Equal(t, types.Client{IP: netip.MustParseAddr("10.0.0.2")}, client, "allowed network is not looked up")
+	assert.Empty(t, w.Result().Header.Get("X-Client-Country"))
+
+	serve(m.Proxies.Wrap(next), "10.0.0.1:1234", "6.6.6.6")
+	assert.True(t, stored)
+	assert.Equal(t, types.Client{IP: netip.MustParseAddr("6.6.6.6")}, client)
+}
+
+// blockingResolver finds the country once released, unless its context is done first.
+type blockingResolver struct {
+	release chan struct{}
+	calls   atomic.Int64
+}
+
+func (b *blockingResolver) Country(ctx context.Context, ip string) (string, error) {
+	b.calls.Add(1)
+	select {
+	case <-b.release:
+		return "CY", nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+func TestCountrySharedLookup(t *testing.T) {
+	resolver := &blockingResolver{release: make(chan struct{})}
+	m := &Country{Resolver: resolver, Cache: NewCountryCache(10, time.Hour, time.Minute)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := m.country(ctx, "1.1.1.1")
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	// the lookup is not canceled with the request which started it
+	close(resolver.release)
+	country, err := m.country(context.Background(), "1.1.1.1")
+	require.NoError(t, err)
+	assert.Equal(t, "CY", country)
+	assert.Equal(t, int64(1), resolver.calls.Load())
 }
@@ -0,0 +1,381 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/netip"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MMDBResolver finds countries in a MaxMind DB file, e.g. GeoLite2-Country.mmdb, so
+// no client address leaves the server. The file is read into memory, Watch reloads
+// it when it changes.
+type MMDBResolver struct {
+	path    string
+	db      atomic.Pointer[mmdb]
+	mutex   sync.Mutex // serializes reloads
+	modTime time.Time
+	size    int64
+}
+
+// OpenMMDB loads the database from the file.
+func OpenMMDB(path string) (*MMDBResolver, error) {
+	r := &MMDBResolver{path: path}
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *MMDBResolver) Country(ctx context.Context, ip string) (string, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return "", err
+	}
+	record, err := r.db.Load().lookup(addr.Unmap())
+	if err != nil || record == nil {
+		return "", err
+	}
+	// the records of country databases are maps, others are not of any use
+	fields, ok := record.(map[string]interface{})
+	if !ok {
+		return "", errInvalidMMDB
+	}
+	for _, key := range []string{"country", "registered_country"} {
+		if m, ok := fields[key].(map[string]interface{}); ok {
+			if code, ok := m["iso_code"].(string); ok && code != "" {
+				return code, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// Reload reads the file again if it has changed since it was loaded. If the new file
+// is not valid, the loaded database is kept.
+func (r *MMDBResolver) Reload() (reloaded bool, err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return false, err
+	}
+	if r.db.Load() != nil && info.ModTime().Equal(r.modTime) && info.Size() == r.size {
+		return false, nil
+	}
+	b, err := os.ReadFile(r.path)
+	if err != nil {
+		return false, err
+	}
+	db, err := parseMMDB(b)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", r.path, err)
+	}
+	r.db.Store(db)
+	r.modTime, r.size = info.ModTime(), info.Size()
+	return true, nil
+}
+
+// Watch checks the file for changes every interval until the context is canceled.
+func (r *MMDBResolver) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		reloaded, err := r.Reload()
+		if err != nil {
+			log.Printf("geo-IP database reload: %v", err)
+		} else if reloaded {
+			log.Printf("geo-IP database %s reloaded", r.path)
+		}
+	}
+}
+
+// mmdb is a MaxMind DB as described at https://maxmind.github.io/MaxMind-DB/.
+type mmdb struct {
+	tree       []byte
+	data       []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	ipv4Start  uint // the node IPv4 addresses start at in an IPv6 tree
+}
+
+var (
+	mmdbMetadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+	errInvalidMMDB     = errors.New("invalid MaxMind DB")
+)
+
+const mmdbDataSeparator = 16
+
+func parseMMDB(b []byte) (*mmdb, error) {
+	i := bytes.LastIndex(b, mmdbMetadataMarker)
+	if i < 0 {
+		return nil, errors.New("MaxMind DB metadata not found")
+	}
+	d := mmdbDecoder{b[i+len(mmdbMetadataMarker):]}
+	v, _, err := d.decode(0)
+	if err != nil {
+		return nil, err
+	}
+	meta, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, errInvalidMMDB
+	}
+	uintField := func(name string) uint {
+		n, _ := meta[name].(uint64)
+		return uint(n)
+	}
+	db := &mmdb{
+		nodeCount:  uintField("node_count"),
+		recordSize: uintField("record_size"),
+		ipVersion:  uintField("ip_version"),
+	}
+	if major := uintField("binary_format_major_version"); major != 2 {
+		return nil, fmt.Errorf("unsupported MaxMind DB format version %d", major)
+	}
+	switch db.recordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("unsupported MaxMind DB record size %d", db.recordSize)
+	}
+	treeSize := db.nodeCount * db.recordSize / 4
+	if db.ipVersion != 4 && db.ipVersion != 6 || treeSize+mmdbDataSeparator > uint(i) {
+		return nil, errInvalidMMDB
+	}
+	db.tree = b[:treeSize]
+	db.data = b[treeSize+mmdbDataSeparator : i]
+	if db.ipVersion == 6 {
+		node := uint(0)
+		for n := 0; n < 96 && node < db.nodeCount; n++ {
+			node = db.record(node, 0)
+		}
+		db.ipv4Start = node
+	}
+	return db, nil
+}
+
+// record returns the left (bit 0) or the right (bit 1) record of the node.
+func (db *mmdb) record(node, bit uint) uint {
+	n := db.tree[node*db.recordSize/4:]
+	switch db.recordSize {
+	case 24:
+		n = n[bit*3:]
+		return uint(n[0])<<16 | uint(n[1])<<8 | uint(n[2])
+	case 28:
+		if bit == 0 {
+			return uint(n[3]&0xF0)<<20 | uint(n[0])<<16 | uint(n[1])<<8 | uint(n[2])
+		}
+		return uint(n[3]&0x0F)<<24 | uint(n[4])<<16 | uint(n[5])<<8 | uint(n[6])
+	default:
+		return uint(binary.BigEndian.Uint32(n[bit*4:]))
+	}
+}
+
+// lookup returns the data record of the address or nil if there is none.
+func (db *mmdb) lookup(addr netip.Addr) (interface{}, error) {
+	node := uint(0)
+	switch {
+	case addr.Is4() && db.ipVersion == 6:
+		node = db.ipv4Start
+	case addr.Is6() && db.ipVersion == 4:
+		return nil, nil
+	}
+	ip := addr.AsSlice()
+	for i := 0; i < len(ip)*8 && node < db.nodeCount; i++ {
+		bit := uint(ip[i/8]>>(7-i%8)) & 1
+		node = db.record(node, bit)
+	}
+	if node <= db.nodeCount {
+		// ran out of address bits in the tree or there is no data for the address
+		if node < db.nodeCount {
+			return nil, errInvalidMMDB
+		}
+		return nil, nil
+	}
+	offset := node - db.nodeCount - mmdbDataSeparator
+	if offset >= uint(len(db.data)) {
+		return nil, errInvalidMMDB
+	}
+	v, _, err := mmdbDecoder{db.data}.decode(offset)
+	return v, err
+}
+
+// mmdbDecoder decodes the MaxMind DB data section format.
+type mmdbDecoder struct {
+	data []byte
+}
+
+const (
+	mmdbPointer = 1
+	mmdbString  = 2
+	mmdbDouble  = 3
+	mmdbBytes   = 4
+	mmdbUint16  = 5
+	mmdbUint32  = 6
+	mmdbMap     = 7
+	mmdbInt32   = 8
+	mmdbUint64  = 9
+	mmdbUint128 = 10
+	mmdbArray   = 11
+	mmdbBool    = 14
+	mmdbFloat   = 15
+)
+
+// decode returns the value at the offset and the offset following it. Maps are decoded
+// as map[string]interface{}, arrays as []interface{}, unsigned integers as uint64 and
+// 128 bit ones as []byte.
+func (d mmdbDecoder) decode(offset uint) (interface{}, uint, error) {
+	kind, size, offset, err := d.control(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	if kind == mmdbPointer {
+		pointer, next, err := d.pointer(size, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		if pointer >= uint(len(d.data)) || d.data[pointer]>>5 == mmdbPointer {
+			return nil, 0, errInvalidMMDB // pointers to pointers are not allowed
+		}
+		v, _, err := d.decode(pointer)
+		return v, next, err
+	}
+	switch kind {
+	case mmdbMap:
+		m := make(map[string]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			var k, v interface{}
+			if k, offset, err = d.decode(offset); err != nil {
+				return nil, 0, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, 0, errInvalidMMDB
+			}
+			if v, offset, err = d.decode(offset); err != nil {
+				return nil, 0, err
+			}
+			m[key] = v
+		}
+		return m, offset, nil
+	case mmdbArray:
+		a := make([]interface{}, 0, size)
+		for i := uint(0); i < size; i++ {
+			var v interface{}
+			if v, offset, err = d.decode(offset); err != nil {
+				return nil, 0, err
+			}
+			a = append(a, v)
+		}
+		return a, offset, nil
+	case mmdbBool:
+		return size != 0, offset, nil
+	}
+	if offset+size > uint(len(d.data)) {
+		return nil, 0, errInvalidMMDB
+	}
+	b, next := d.data[offset:offset+size], offset+size
+	switch kind {
+	case mmdbString:
+		return string(b), next, nil
+	case mmdbBytes, mmdbUint128:
+		return b, next, nil
+	case mmdbDouble:
+		if size != 8 {
+			return nil, 0, errInvalidMMDB
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), next, nil
+	case mmdbFloat:
+		if size != 4 {
+			return nil, 0, errInvalidMMDB
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(b)), next, nil
+	case mmdbUint16, mmdbUint32, mmdbUint64, mmdbInt32:
+		if size > 8 {
+			return nil, 0, errInvalidMMDB
+		}
+		var n uint64
+		for _, c := range b {
+			n = n<<8 | uint64(c)
+		}
+		if kind == mmdbInt32 {
+			return int64(int32(n)), next, nil
+		}
+		return n, next, nil
+	}
+	return nil, 0, fmt.Errorf("unsupported MaxMind DB data type %d", kind)
+}
+
+// control decodes the control byte(s) at the offset, returning the type and the size
+// of the value and the offset of its payload.
+func (d mmdbDecoder) control(offset uint) (kind, size, next uint, err error) {
+	if offset >= uint(len(d.data)) {
+		return 0, 0, 0, errInvalidMMDB
+	}
+	c := d.data[offset]
+	offset++
+	kind = uint(c >> 5)
+	if kind == 0 {
+		if offset >= uint(len(d.data)) {
+			return 0, 0, 0, errInvalidMMDB
+		}
+		kind = 7 + uint(d.data[offset])
+		offset++
+	}
+	size = uint(c & 0x1F)
+	if kind == mmdbPointer || size < 29 {
+		return kind, size, offset, nil
+	}
+	n := size - 28
+	if offset+n > uint(len(d.data)) {
+		return 0, 0, 0, errInvalidMMDB
+	}
+	var extra uint
+	for _, b := range d.data[offset : offset+n] {
+		extra = extra<<8 | uint(b)
+	}
+	switch size {
+	case 29:
+		size = 29 + extra
+	case 30:
+		size = 285 + extra
+	default:
+		size = 65821 + extra
+	}
+	return kind, size, offset + n, nil
+}
+
+// pointer decodes a pointer, size holds the five low bits of its control byte.
+func (d mmdbDecoder) pointer(size, offset uint) (pointer, next uint, err error) {
+	n := size>>3 + 1
+	if offset+n > uint(len(d.data)) {
+		return 0, 0, errInvalidMMDB
+	}
+	var p uint
+	if n < 4 {
+		p = size & 0x7
+	}
+	for _, b := range d.data[offset : offset+n] {
+		p = p<<8 | uint(b)
+	}
+	switch n {
+	case 2:
+		p += 2048
+	case 3:
+		p += 526336
+	}
+	return p, offset + n, nil
+}
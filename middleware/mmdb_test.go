@@ -0,0 +1,226 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mmdbControl encodes a control byte of a MaxMind DB value, size must be less than 29.
+func mmdbControl(kind, size int) []byte {
+	if kind <= mmdbMap {
+		return []byte{byte(kind<<5 | size)}
+	}
+	return []byte{byte(size), byte(kind - 7)}
+}
+
+func mmdbUint(kind int, n uint64) []byte {
+	var b []byte
+	for ; n > 0; n >>= 8 {
+		b = append([]byte{byte(n)}, b...)
+	}
+	return append(mmdbControl(kind, len(b)), b...)
+}
+
+func mmdbText(s string) []byte {
+	return append(mmdbControl(mmdbString, len(s)), s...)
+}
+
+// mmdbObject encodes a map from alternating keys and encoded values.
+func mmdbObject(kv ...interface{}) []byte {
+	b := mmdbControl(mmdbMap, len(kv)/2)
+	for i := 0; i < len(kv); i += 2 {
+		b = append(b, mmdbText(kv[i].(string))...)
+		b = append(b, kv[i+1].([]byte)...)
+	}
+	return b
+}
+
+type mmdbNetwork struct {
+	prefix string
+	data   []byte // encoded record, pointers are relative to the start of the data section
+}
+
+// writeMMDB writes a MaxMind DB with the networks, which must not overlap. IPv4
+// networks in an IPv6 database are placed at ::/96.
+func writeMMDB(t *testing.T, path string, ipVersion, recordSize int, networks []mmdbNetwork) {
+	// records are node indexes, -1 for no data, -2-k for the data of the k-th network
+	nodes := [][2]int{{-1, -1}}
+	var data []byte
+	offsets := make([]int, len(networks))
+	for k, n := range networks {
+		prefix := netip.MustParsePrefix(n.prefix)
+		ip, bits := prefix.Addr().AsSlice(), prefix.Bits()
+		if ipVersion == 6 && len(ip) == 4 {
+			ip, bits = append(make([]byte, 12), ip...), bits+96
+		}
+		node := 0
+		for i := 0; i < bits; i++ {
+			bit := ip[i/8] >> (7 - i%8) & 1
+			if i == bits-1 {
+				nodes[node][bit] = -2 - k
+				break
+			}
+			if nodes[node][bit] < 0 {
+				nodes = append(nodes, [2]int{-1, -1})
+				nodes[node][bit] = len(nodes) - 1
+			}
+			node = nodes[node][bit]
+		}
+		offsets[k] = len(data)
+		data = append(data, n.data...)
+	}
+
+	var b bytes.Buffer
+	nodeCount := len(nodes)
+	for _, node := range nodes {
+		var r [2]uint32
+		for i, v := range node {
+			switch {
+			case v >= 0:
+				r[i] = uint32(v)
+			case v == -1:
+				r[i] = uint32(nodeCount)
+			default:
+				r[i] = uint32(nodeCount + mmdbDataSeparator + offsets[-2-v])
+			}
+		}
+		switch recordSize {
+		case 24:
+			b.Write([]byte{byte(r[0] >> 16), byte(r[0] >> 8), byte(r[0])})
+			b.Write([]byte{byte(r[1] >> 16), byte(r[1] >> 8), byte(r[1])})
+		case 28:
+			b.Write([]byte{byte(r[0] >> 16), byte(r[0] >> 8), byte(r[0])})
+			b.WriteByte(byte(r[0]>>24<<4 | r[1]>>24))
+			b.Write([]byte{byte(r[1] >> 16), byte(r[1] >> 8), byte(r[1])})
+		case 32:
+			b.Write([]byte{byte(r[0] >> 24), byte(r[0] >> 16), byte(r[0] >> 8), byte(r[0])})
+			b.Write([]byte{byte(r[1] >> 24), byte(r[1] >> 16), byte(r[1] >> 8), byte(r[1])})
+		}
+	}
+	b.Write(make([]byte, mmdbDataSeparator))
+	b.Write(data)
+	b.Write(mmdbMetadataMarker)
+	b.Write(mmdbObject(
+		"node_count", mmdbUint(mmdbUint32, uint64(nodeCount)),
+		"record_size", mmdbUint(mmdbUint16, uint64(recordSize)),
+		"ip_version", mmdbUint(mmdbUint16, uint64(ipVersion)),
+		"database_type", mmdbText("Test-Country"),
+		"languages", append(mmdbControl(mmdbArray, 1), mmdbText("en")...),
+		"binary_format_major_version", mmdbUint(mmdbUint16, 2),
+		"binary_format_minor_version", mmdbUint(mmdbUint16, 0),
+		"build_epoch", mmdbUint(mmdbUint64, uint64(time.Now().Unix())),
+	))
+	require.NoError(t, os.WriteFile(path, b.Bytes(), 0o644))
+}
+
+func countryRecord(code string) []byte {
+	return mmdbObject("country", mmdbObject("iso_code", mmdbText(code)))
+}
+
+func TestMMDBResolver(t *testing.T) {
+	ctx := context.Background()
+	cy := countryRecord("CY")
+	us := mmdbObject(
+		"country", mmdbObject(
+			"geoname_id", mmdbUint(mmdbUint32, 6252001),
+			"iso_code", mmdbText("US"),
+			"names", mmdbObject("en", mmdbText("United States")),
+		),
+		"traits", mmdbObject("is_anycast", mmdbControl(mmdbBool, 1)),
+	)
+	// registered country only, pointing to the country map of the first record
+	registered := mmdbObject("registered_country", []byte{mmdbPointer << 5, byte(len(mmdbControl(mmdbMap, 1)) + len(mmdbText("country")))})
+	networks := []mmdbNetwork{
+		{"1.1.1.0/24", cy},
+		{"8.8.8.8/32", us},
+		{"2001:db8::/32", registered},
+		// not a country record
+		{"9.9.9.9/32", mmdbText("CY")},
+	}
+
+	for _, tt := range []struct {
+		ipVersion, recordSize int
+	}{{6, 24}, {6, 28}, {6, 32}, {4, 24}} {
+		t.Run(fmt.Sprintf("IPv%d %d bit records", tt.ipVersion, tt.recordSize), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.mmdb")
+			n := networks
+			if tt.ipVersion == 4 {
+				n = append(networks[:2:2], networks[3])
+			}
+			writeMMDB(t, path, tt.ipVersion, tt.recordSize, n)
+			r, err := OpenMMDB(path)
+			require.NoError(t, err)
+
+			for ip, want := range map[string]string{
+				"1.1.1.1":          "CY",
+				"::ffff:1.1.1.255": "CY",
+				"8.8.8.8":          "US",
+				"8.8.8.9":          "",
+				"10.0.0.1":         "",
+				"2001:db9::1":      "",
+			} {
+				country, err := r.Country(ctx, ip)
+				require.NoError(t, err, ip)
+				assert.Equal(t, want, country, ip)
+			}
+			country, err := r.Country(ctx, "2001:db8::1")
+			require.NoError(t, err)
+			if tt.ipVersion == 6 {
+				assert.Equal(t, "CY", country)
+			} else {
+				assert.Empty(t, country)
+			}
+
+			_, err = r.Country(ctx, "9.9.9.9")
+			assert.Equal(t, errInvalidMMDB, err)
+
+			_, err = r.Country(ctx, "x")
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestMMDBReload(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	_, err := OpenMMDB(path)
+	assert.Error(t, err)
+	require.NoError(t, os.WriteFile(path, []byte("not a database"), 0o644))
+	_, err = OpenMMDB(path)
+	assert.Error(t, err)
+
+	writeMMDB(t, path, 6, 24, []mmdbNetwork{{"1.1.1.0/24", countryRecord("CY")}})
+	r, err := OpenMMDB(path)
+	require.NoError(t, err)
+	reloaded, err := r.Reload()
+	require.NoError(t, err)
+	assert.False(t, reloaded, "file has not changed")
+
+	modified := time.Now().Add(time.Minute)
+	writeMMDB(t, path, 6, 24, []mmdbNetwork{{"1.1.1.0/24", countryRecord("DE")}})
+	require.NoError(t, os.Chtimes(path, modified, modified))
+	reloaded, err = r.Reload()
+	require.NoError(t, err)
+	assert.True(t, reloaded)
+	country, err := r.Country(ctx, "1.1.1.1")
+	require.NoError(t, err)
+	assert.Equal(t, "DE", country)
+
+	modified = modified.Add(time.Minute)
+	require.NoError(t, os.WriteFile(path, []byte("truncated"), 0o644))
+	require.NoError(t, os.Chtimes(path, modified, modified))
+	_, err = r.Reload()
+	assert.Error(t, err)
+	country, err = r.Country(ctx, "1.1.1.1")
+	require.NoError(t, err)
+	assert.Equal(t, "DE", country, "invalid file must not replace the loaded database")
+}
@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// CountryPolicy decides which clients are allowed. The rules are evaluated in order,
+// the first one matching decides:
+//
+//  1. an address in DenyNetworks is denied;
+//  2. an address in AllowNetworks is allowed, e.g. an office network or CI runners;
+//  3. a special-purpose address (see ClassifyAddress) of a class in
+//     AllowAddressClasses is allowed;
+//  4. a country in DenyCountries is denied;
+//  5. a country in AllowCountries is allowed;
+//  6. any other country is denied, so is every one if AllowCountries is empty.
+//
+// The country is only looked up for public addresses no network rule matches.
+// Clients the country of which is not known, e.g. having a special-purpose address,
+// are treated as coming from the country with the empty code.
+type CountryPolicy struct {
+	AllowNetworks []netip.Prefix
+	DenyNetworks  []netip.Prefix
+	// AllowAddressClasses are the special-purpose addresses allowed without a lookup,
+	// e.g. loopback for local development or private for internal callers.
+	AllowAddressClasses []AddressClass
+	// AllowCountries and DenyCountries are ISO 3166-1 alpha-2 codes in upper case.
+	// AnyCountry in AllowCountries allows all the countries which are not denied.
+	AllowCountries []string
+	DenyCountries  []string
+}
+
+// Allowed applies the policy to the client address, country is called to find its
+// country if needed.
+func (p *CountryPolicy) Allowed(addr netip.Addr, country func() (string, error)) (bool, error) {
+	if containsAddr(p.DenyNetworks, addr) {
+		return false, nil
+	}
+	if containsAddr(p.AllowNetworks, addr) {
+		return true, nil
+	}
+	code := ""
+	if class := ClassifyAddress(addr); class != PublicAddress {
+		for _, c := range p.AllowAddressClasses {
+			if c == class {
+				return true, nil
+			}
+		}
+	} else {
+		var err error
+		if code, err = country(); err != nil {
+			return false, err
+		}
+	}
+	if containsString(p.DenyCountries, code) {
+		return false, nil
+	}
+	return containsString(p.AllowCountries, code) || containsString(p.AllowCountries, AnyCountry), nil
+}
+
+// AnyCountry stands for all the countries in CountryPolicy.AllowCountries.
+const AnyCountry = "*"
+
+// ParseCountryCodes parses a comma separated list of country codes, AnyCountry is
+// accepted as well.
+func ParseCountryCodes(s string) ([]string, error) {
+	var codes []string
+	for _, v := range strings.Split(s, ",") {
+		v = strings.ToUpper(strings.TrimSpace(v))
+		if v == "" {
+			continue
+		}
+		if v == AnyCountry {
+			codes = append(codes, v)
+			continue
+		}
+		if len(v) != 2 || v[0] < 'A' || v[0] > 'Z' || v[1] < 'A' || v[1] > 'Z' {
+			return nil, fmt.Errorf("invalid country code %q", v)
+		}
+		codes = append(codes, v)
+	}
+	return codes, nil
+}
+
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	addr = addr.WithZone("")
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCountryPolicy(t *testing.T) {
+	networks := func(s string) []netip.Prefix {
+		prefixes, err := ParsePrefixes(s)
+		require.NoError(t, err)
+		return prefixes
+	}
+	errLookup := errors.New("lookup failed")
+	policy := &CountryPolicy{
+		AllowNetworks:  networks("10.0.0.0/8, 5.6.7.8"),
+		DenyNetworks:   networks("10.6.6.0/24"),
+		AllowCountries: []string{"CY", "GR"},
+		DenyCountries:  []string{"GR"},
+	}
+	for _, tt := range []struct {
+		name    string
+		policy  *CountryPolicy
+		addr    string
+		country string // the lookup fails if empty
+		allowed bool
+		lookup  bool // whether the country is looked up
+	}{
+		{"denied network wins over allowed network", policy, "10.6.6.6", "CY", false, false},
+		{"allowed network", policy, "10.1.1.1", "", true, false},
+		{"allowed address", policy, "5.6.7.8", "", true, false},
+		{"denied country wins over allowed country", policy, "5.5.5.5", "GR", false, true},
+		{"allowed country", policy, "5.5.5.5", "CY", true, true},
+		{"other country", policy, "5.5.5.5", "US", false, true},
+		{"no allowed countries", &CountryPolicy{DenyCountries: []string{"GR"}}, "5.5.5.5", "US", false, true},
+		{"no countries", &CountryPolicy{}, "5.5.5.5", "GR", false, true},
+		{"any country", &CountryPolicy{AllowCountries: []string{AnyCountry}, DenyCountries: []string{"GR"}}, "5.5.5.5", "US", true, true},
+		{"denied country wins over any country", &CountryPolicy{AllowCountries: []string{AnyCountry}, DenyCountries: []string{"GR"}}, "5.5.5.5", "GR", false, true},
+		{"allowed address class", &CountryPolicy{
+			AllowCountries:      []string{"CY"},
+			AllowAddressClasses: []AddressClass{LoopbackAddress},
+		}, "::1", "", true, false},
+		{"other address class", &CountryPolicy{
+			AllowCountries:      []string{"CY"},
+			AllowAddressClasses: []AddressClass{LoopbackAddress},
+		}, "192.168.1.1", "", false, false},
+		{"special address with no allowed countries", &CountryPolicy{}, "fe80::1%eth0", "", false, false},
+		{"special address with any country", &CountryPolicy{AllowCountries: []string{AnyCountry}}, "fe80::1%eth0", "", true, false},
+		{"denied network wins over address class", &CountryPolicy{
+			DenyNetworks:        networks("fe80::/10"),
+			AllowAddressClasses: []AddressClass{LinkLocalAddress},
+		}, "fe80::1%eth0", "", false, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			looked := false
+			allowed, err := tt.policy.Allowed(netip.MustParseAddr(tt.addr), func() (string, error) {
+				looked = true
+				if tt.country == "" {
+					return "", errLookup
+				}
+				return tt.country, nil
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tt.allowed, allowed)
+			assert.Equal(t, tt.lookup, looked)
+		})
+	}
+
+	t.Run("lookup failure", func(t *testing.T) {
+		_, err := policy.Allowed(netip.MustParseAddr("5.5.5.5"), func() (string, error) { return "", errLookup })
+		assert.Equal(t, errLookup, err)
+	})
+
+	t.Run("unknown country", func(t *testing.T) {
+		allowed, err := policy.Allowed(netip.MustParseAddr("5.5.5.5"), func() (string, error) { return "", nil })
+		require.NoError(t, err)
+		assert.False(t, allowed)
+	})
+}
+
+func TestParseCountryCodes(t *testing.T) {
+	codes, err := ParseCountryCodes("cy, GR,,")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"CY", "GR"}, codes)
+
+	codes, err = ParseCountryCodes("*")
+	require.NoError(t, err)
+	assert.Equal(t, []string{AnyCountry}, codes)
+
+	_, err = ParseCountryCodes("CY,Cyprus")
+	assert.Error(t, err)
+	_, err = ParseCountryCodes("C1")
+	assert.Error(t, err)
+}
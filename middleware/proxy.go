@@ -0,0 +1,185 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/irmatov/companies/types"
+)
+
+// Proxies finds the address of the client behind the trusted proxies.
+type Proxies struct {
+	// Trusted are the networks of the proxies in front of the service. The forwarding
+	// header is only believed as far as it was added by one of them.
+	Trusted []netip.Prefix
+	// Header the proxies put the client address into: "X-Forwarded-For" (the default),
+	// "X-Real-IP" or "Forwarded" (RFC 7239). The other ones are ignored, clients may
+	// send any of them.
+	Header string
+}
+
+// ParsePrefixes parses a comma separated list of networks in CIDR notation, single
+// addresses are accepted as well.
+func ParsePrefixes(s string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if !strings.Contains(v, "/") {
+			addr, err := netip.ParseAddr(v)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(v)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+var errInvalidForwarded = errors.New("invalid forwarded address")
+
+// ClientIP returns the address of the client. The addresses in the forwarding header
+// are walked right to left, starting with the peer address, until one that is not
+// a trusted proxy is found; the ones before it may be forged by the client.
+// IPv4-mapped IPv6 addresses are returned as IPv4 ones, without IPv6 zones.
+func (p *Proxies) ClientIP(r *http.Request) (netip.Addr, error) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	addr = addr.Unmap().WithZone("")
+	if p == nil || !p.trusted(addr) {
+		return addr, nil
+	}
+	hops, err := p.hops(r.Header)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := parseHop(hops[i])
+		if err != nil {
+			return netip.Addr{}, fmt.Errorf("%w %q", errInvalidForwarded, hops[i])
+		}
+		addr = hop
+		if !p.trusted(addr) {
+			break
+		}
+	}
+	return addr, nil
+}
+
+// Wrap returns a handler storing the client address in the request context, see
+// types.ClientFromContext, before passing the request to next. Country replaces it
+// with the one including the country for the requests it checks.
+func (p *Proxies) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if addr, err := p.ClientIP(r); err == nil {
+			r = r.WithContext(types.WithClient(r.Context(), types.Client{IP: addr}))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (p *Proxies) trusted(addr netip.Addr) bool {
+	return containsAddr(p.Trusted, addr)
+}
+
+// hops returns the forwarded addresses from the header, the nearest proxy last.
+func (p *Proxies) hops(h http.Header) ([]string, error) {
+	var hops []string
+	switch http.CanonicalHeaderKey(p.Header) {
+	case "", "X-Forwarded-For":
+		for _, v := range h.Values("X-Forwarded-For") {
+			hops = append(hops, strings.Split(v, ",")...)
+		}
+	case "X-Real-Ip":
+		hops = h.Values("X-Real-IP")
+	case "Forwarded":
+		for _, v := range h.Values("Forwarded") {
+			elements, err := parseForwarded(v)
+			if err != nil {
+				return nil, err
+			}
+			hops = append(hops, elements...)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported forwarding header %s", p.Header)
+	}
+	return hops, nil
+}
+
+// parseForwarded returns the "for" parameters of the Forwarded header elements, an
+// empty string for the elements without one.
+func parseForwarded(v string) ([]string, error) {
+	var hops []string
+	hop, quoted, start := "", false, 0
+	param := func(end int) error {
+		name, value, ok := strings.Cut(strings.TrimSpace(v[start:end]), "=")
+		if !ok {
+			if name == "" {
+				return nil
+			}
+			return fmt.Errorf("%w %q", errInvalidForwarded, v)
+		}
+		if strings.HasPrefix(value, `"`) {
+			if len(value) < 2 || !strings.HasSuffix(value, `"`) {
+				return fmt.Errorf("%w %q", errInvalidForwarded, v)
+			}
+			value = strings.ReplaceAll(value[1:len(value)-1], `\`, "")
+		}
+		if strings.EqualFold(name, "for") {
+			hop = value
+		}
+		return nil
+	}
+	for i := 0; i <= len(v); i++ {
+		switch {
+		case i < len(v) && v[i] == '"':
+			quoted = !quoted
+		case i < len(v) && v[i] == '\\' && quoted:
+			i++
+		case i == len(v) || !quoted && (v[i] == ';' || v[i] == ','):
+			if err := param(i); err != nil {
+				return nil, err
+			}
+			start = i + 1
+			if i == len(v) || v[i] == ',' {
+				hops = append(hops, hop)
+				hop = ""
+			}
+		}
+	}
+	return hops, nil
+}
+
+// parseHop parses a forwarded address, which may have a port, IPv6 addresses may be
+// in brackets.
+func parseHop(s string) (netip.Addr, error) {
+	s = strings.TrimSpace(s)
+	if addr, err := netip.ParseAddr(s); err == nil {
+		return addr.Unmap().WithZone(""), nil
+	}
+	if strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]") {
+		s = s[1 : len(s)-1]
+	} else if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	addr, err := netip.ParseAddr(s)
+	return addr.Unmap().WithZone(""), err
+}
@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePrefixes(t *testing.T) {
+	prefixes, err := ParsePrefixes("10.0.0.0/8, 192.168.1.10,2001:db8::1/32 ,")
+	require.NoError(t, err)
+	assert.Equal(t, []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("192.168.1.10/32"),
+		netip.MustParsePrefix("2001:db8::/32"),
+	}, prefixes)
+
+	prefixes, err = ParsePrefixes("")
+	require.NoError(t, err)
+	assert.Empty(t, prefixes)
+
+	_, err = ParsePrefixes("10.0.0.0/8,proxy")
+	assert.Error(t, err)
+}
+
+func TestClientIP(t *testing.T) {
+	trusted, err := ParsePrefixes("10.0.0.0/8,2001:db8::/32")
+	require.NoError(t, err)
+	for _, tt := range []struct {
+		name       string
+		header     string // Proxies.Header
+		remoteAddr string
+		headers    map[string][]string
+		want       string // empty if an error is expected
+	}{
+		{"no proxies", "", "1.1.1.1:1234", nil, "1.1.1.1"},
+		{"IPv4-mapped peer", "", "[::ffff:1.1.1.1]:1234", nil, "1.1.1.1"},
+		{"forged header from untrusted peer", "", "1.1.1.1:1234",
+			map[string][]string{"X-Forwarded-For": {"5.5.5.5"}}, "1.1.1.1"},
+		{"trusted peer without header", "", "10.0.0.1:1234", nil, "10.0.0.1"},
+		{"IPv6 peer with zone", "", "[fe80::1%eth0]:1234", nil, "fe80::1"},
+		{"IPv6 client", "", "10.0.0.1:1234",
+			map[string][]string{"X-Forwarded-For": {"2a00:1450::17, ::ffff:10.0.0.2"}}, "2a00:1450::17"},
+		{"X-Forwarded-For", "", "10.0.0.1:1234",
+			map[string][]string{"X-Forwarded-For": {"5.5.5.5"}}, "5.5.5.5"},
+		{"forged X-Forwarded-For entries", "", "10.0.0.1:1234",
+			map[string][]string{"X-Forwarded-For": {"6.6.6.6, garbage, 10.0.0.3, 5.5.5.5"}}, "5.5.5.5"},
+		{"chain of proxies", "X-Forwarded-For", "10.0.0.1:1234",
+			map[string][]string{"X-Forwarded-For": {"6.6.6.6, 5.5.5.5", "10.0.0.2"}}, "5.5.5.5"},
+		{"only proxies", "", "10.0.0.1:1234",
+			map[string][]string{"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"}}, "10.0.0.3"},
+		{"invalid address from proxy", "", "10.0.0.1:1234",
+			map[string][]string{"X-Forwarded-For": {"5.5.5.5, garbage"}}, ""},
+		{"X-Real-IP", "X-Real-IP", "10.0.0.1:1234", map[string][]string{
+			"X-Forwarded-For": {"6.6.6.6"},
+			"X-Real-Ip":       {"5.5.5.5"},
+		}, "5.5.5.5"},
+		{"X-Forwarded-For is ignored", "X-Real-IP", "10.0.0.1:1234",
+			map[string][]string{"X-Forwarded-For": {"6.6.6.6"}}, "10.0.0.1"},
+		{"Forwarded", "Forwarded", "[2001:db8::1]:1234", map[string][]string{
+			"Forwarded": {`for=6.6.6.6;proto=https, For="[2001:db8:cafe::17]:4711";by=10.0.0.2`, `for="5.5.5.5:80", for=10.0.0.2`},
+		}, "5.5.5.5"},
+		{"Forwarded with quoted separators", "Forwarded", "10.0.0.1:1234", map[string][]string{
+			"Forwarded": {`for=6.6.6.6;host="a,b;c", for="[2a00:1450::17]:4711"`},
+		}, "2a00:1450::17"},
+		{"forged Forwarded is ignored", "", "10.0.0.1:1234", map[string][]string{
+			"X-Forwarded-For": {"5.5.5.5"},
+			"Forwarded":       {"for=6.6.6.6"},
+		}, "5.5.5.5"},
+		{"Forwarded without for", "Forwarded", "10.0.0.1:1234",
+			map[string][]string{"Forwarded": {"for=5.5.5.5, proto=https"}}, ""},
+		{"obfuscated Forwarded", "Forwarded", "10.0.0.1:1234",
+			map[string][]string{"Forwarded": {"for=5.5.5.5, for=_hidden"}}, ""},
+		{"unsupported header", "X-Client-IP", "10.0.0.1:1234", nil, ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for k, v := range tt.headers {
+				r.Header[k] = v
+			}
+			p := &Proxies{Trusted: trusted, Header: tt.header}
+			addr, err := p.ClientIP(r)
+			if tt.want == "" {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, addr.String())
+		})
+	}
+
+	t.Run("nil", func(t *testing.T) {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = "10.0.0.1:1234"
+		r.Header.Set("X-Forwarded-For", "5.5.5.5")
+		addr, err := (*Proxies)(nil).ClientIP(r)
+		require.NoError(t, err)
+		assert.Equal(t, "10.0.0.1", addr.String())
+	})
+}
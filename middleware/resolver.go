@@ -0,0 +1,142 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CountryResolver finds the country an IP address is located in.
+type CountryResolver interface {
+	// Country returns ISO 3166-1 alpha-2 code of the country. An empty code is returned
+	// if the address is not located in any country, e.g. it is a private one.
+	Country(ctx context.Context, ip string) (string, error)
+}
+
+// Lookup URL formats of the supported web services, %s is replaced by the IP address.
+const (
+	IPAPICoURLFormat  = "https://ipapi.co/%s/json/"
+	IPAPIComURLFormat = "http://ip-api.com/json/%s?fields=status,message,countryCode"
+	IPInfoURLFormat   = "https://ipinfo.io/%s/json"
+)
+
+// HTTPResolver looks countries up with a web service.
+type HTTPResolver struct {
+	// URLFormat is the lookup URL with %s in place of the IP address.
+	URLFormat string
+	Client    *http.Client
+	// Header is added to the lookup requests, e.g. for authorization.
+	Header http.Header
+	// Decode extracts the country code from a successful response body.
+	Decode func(body io.Reader) (string, error)
+}
+
+// NewIPAPICo creates a resolver using ipapi.co.
+func NewIPAPICo(client *http.Client) *HTTPResolver {
+	return &HTTPResolver{URLFormat: IPAPICoURLFormat, Client: client, Decode: DecodeIPAPICo}
+}
+
+// NewIPAPICom creates a resolver using ip-api.com. The addresses are sent in plain
+// text, the free service is not available over HTTPS.
+func NewIPAPICom(client *http.Client) *HTTPResolver {
+	return &HTTPResolver{URLFormat: IPAPIComURLFormat, Client: client, Decode: DecodeIPAPICom}
+}
+
+// NewIPInfo creates a resolver using ipinfo.io, the token may be empty.
+func NewIPInfo(client *http.Client, token string) *HTTPResolver {
+	r := &HTTPResolver{URLFormat: IPInfoURLFormat, Client: client, Decode: DecodeIPInfo}
+	if token != "" {
+		r.Header = http.Header{"Authorization": {"Bearer " + token}}
+	}
+	return r
+}
+
+func (r *HTTPResolver) Country(ctx context.Context, ip string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf(r.URLFormat, ip), nil)
+	if err != nil {
+		return "", err
+	}
+	for k, v := range r.Header {
+		req.Header[k] = v
+	}
+	resp, err := r.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", &statusError{resp.StatusCode, parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())}
+	}
+	return r.Decode(resp.Body)
+}
+
+// DecodeIPAPICo decodes an ipapi.co response.
+func DecodeIPAPICo(body io.Reader) (string, error) {
+	var data struct {
+		CountryCode string `json:"country_code"`
+		Error       bool   `json:"error"`
+		Reason      string `json:"reason"`
+		Reserved    bool   `json:"reserved"`
+	}
+	if err := json.NewDecoder(body).Decode(&data); err != nil {
+		return "", err
+	}
+	if data.Error && !data.Reserved {
+		return "", fmt.Errorf("ipapi.co: %s", data.Reason)
+	}
+	return data.CountryCode, nil
+}
+
+// DecodeIPAPICom decodes an ip-api.com response.
+func DecodeIPAPICom(body io.Reader) (string, error) {
+	var data struct {
+		Status      string `json:"status"`
+		Message     string `json:"message"`
+		CountryCode string `json:"countryCode"`
+	}
+	if err := json.NewDecoder(body).Decode(&data); err != nil {
+		return "", err
+	}
+	if data.Status != "success" {
+		if strings.HasSuffix(data.Message, " range") { // private range, reserved range
+			return "", nil
+		}
+		return "", fmt.Errorf("ip-api.com: %s", data.Message)
+	}
+	return data.CountryCode, nil
+}
+
+// DecodeIPInfo decodes an ipinfo.io response.
+func DecodeIPInfo(body io.Reader) (string, error) {
+	var data struct {
+		Country string `json:"country"`
+		Bogon   bool   `json:"bogon"`
+	}
+	if err := json.NewDecoder(body).Decode(&data); err != nil {
+		return "", err
+	}
+	if data.Country == "" && !data.Bogon {
+		return "", errors.New("ipinfo.io: no country in the response")
+	}
+	return data.Country, nil
+}
+
+// ChainResolver asks the resolvers in order until one of them succeeds.
+type ChainResolver []CountryResolver
+
+func (c ChainResolver) Country(ctx context.Context, ip string) (string, error) {
+	err := errors.New("no country resolvers")
+	for _, r := range c {
+		var country string
+		country, err = r.Country(ctx, ip)
+		if err == nil || ctx.Err() != nil {
+			return country, err
+		}
+	}
+	return "", err
+}
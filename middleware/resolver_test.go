@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testService stands in for a lookup service, it responds with the body given for the
+// requested path.
+func testService(t *testing.T, responses map[string]string) *httptest.Server {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := responses[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestResolvers(t *testing.T) {
+	ctx := context.Background()
+	for _, tt := range []struct {
+		name        string
+		newResolver func(url string) *HTTPResolver
+		responses   map[string]string
+	}{
+		{"ipapi.co", func(url string) *HTTPResolver {
+			r := NewIPAPICo(&http.Client{})
+			r.URLFormat = url + "/%s/json/"
+			return r
+		}, map[string]string{
+			"/8.8.8.8/json/":  `{"ip": "8.8.8.8", "country_code": "US"}`,
+			"/10.0.0.1/json/": `{"ip": "10.0.0.1", "error": true, "reason": "Reserved IP Address", "reserved": true}`,
+			"/x/json/":        `{"ip": "x", "error": true, "reason": "Invalid IP Address"}`,
+		}},
+		{"ip-api.com", func(url string) *HTTPResolver {
+			r := NewIPAPICom(&http.Client{})
+			r.URLFormat = url + "/json/%s"
+			return r
+		}, map[string]string{
+			"/json/8.8.8.8":  `{"status": "success", "countryCode": "US"}`,
+			"/json/10.0.0.1": `{"status": "fail", "message": "private range"}`,
+			"/json/x":        `{"status": "fail", "message": "invalid query"}`,
+		}},
+		{"ipinfo.io", func(url string) *HTTPResolver {
+			r := NewIPInfo(&http.Client{}, "token")
+			r.URLFormat = url + "/%s/json"
+			return r
+		}, map[string]string{
+			"/8.8.8.8/json":  `{"ip": "8.8.8.8", "country": "US"}`,
+			"/10.0.0.1/json": `{"ip": "10.0.0.1", "bogon": true}`,
+			"/x/json":        `{"status": 404, "error": {"title": "Wrong ip"}}`,
+		}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r := tt.newResolver(testService(t, tt.responses).URL)
+			country, err := r.Country(ctx, "8.8.8.8")
+			require.NoError(t, err)
+			assert.Equal(t, "US", country)
+
+			country, err = r.Country(ctx, "10.0.0.1")
+			require.NoError(t, err)
+			assert.Empty(t, country)
+
+			_, err = r.Country(ctx, "x")
+			assert.Error(t, err)
+
+			_, err = r.Country(ctx, "1.1.1.1")
+			assert.Equal(t, &statusError{status: http.StatusServiceUnavailable}, err)
+		})
+	}
+}
+
+func TestChainResolver(t *testing.T) {
+	ctx := context.Background()
+	failing := testService(t, nil)
+	working := testService(t, map[string]string{"/8.8.8.8": `{"country_code": "US"}`})
+	resolver := func(url string) CountryResolver {
+		return &HTTPResolver{URLFormat: url + "/%s", Client: &http.Client{}, Decode: DecodeIPAPICo}
+	}
+
+	country, err := ChainResolver{resolver(failing.URL), resolver(working.URL)}.Country(ctx, "8.8.8.8")
+	require.NoError(t, err)
+	assert.Equal(t, "US", country)
+
+	_, err = ChainResolver{resolver(working.URL), resolver(failing.URL)}.Country(ctx, "1.1.1.1")
+	assert.Equal(t, &statusError{status: http.StatusServiceUnavailable}, err)
+
+	_, err = ChainResolver{}.Country(ctx, "8.8.8.8")
+	assert.Error(t, err)
+}
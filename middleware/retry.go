@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy limits retries of failed lookups. The delay before a retry starts at
+// Backoff and doubles up to MaxBackoff. A delay requested by the service with
+// Retry-After is honoured, unless it is longer than MaxBackoff, in which case the
+// lookup fails without further retries.
+type RetryPolicy struct {
+	// Attempts is the maximum number of attempts, a single one is made if it is zero.
+	Attempts   int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// statusError is an unexpected response of the lookup service.
+type statusError struct {
+	status     int
+	retryAfter time.Duration
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("lookup service responded with %d %s", e.status, http.StatusText(e.status))
+}
+
+// isServiceFailure tells if the lookup failed because of the service rather than the
+// request, such failures are retried and counted by the circuit breaker.
+func isServiceFailure(err error) bool {
+	if err == ErrBreakerOpen || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if e, ok := err.(*statusError); ok {
+		return e.status == http.StatusTooManyRequests || e.status >= http.StatusInternalServerError
+	}
+	return true
+}
+
+// retry calls fn until it succeeds, fails in a way which is not worth retrying or the
+// attempts are exhausted.
+func (p RetryPolicy) retry(ctx context.Context, fn func() error, retried func()) error {
+	backoff := p.Backoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || !isServiceFailure(err) || attempt >= p.Attempts {
+			return err
+		}
+		delay := backoff
+		if e, ok := err.(*statusError); ok && e.retryAfter > 0 {
+			if p.MaxBackoff > 0 && e.retryAfter > p.MaxBackoff {
+				return err
+			}
+			delay = e.retryAfter
+		}
+		backoff *= 2
+		if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+			backoff = p.MaxBackoff
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		retried()
+	}
+}
+
+// parseRetryAfter parses the value of Retry-After header, which is either a number
+// of seconds or an HTTP date. Zero is returned if the value is not valid.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
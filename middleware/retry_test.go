@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, 5*time.Second, parseRetryAfter("5", now))
+	assert.Equal(t, time.Minute, parseRetryAfter(now.Add(time.Minute).Format(http.TimeFormat), now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter(now.Add(-time.Minute).Format(http.TimeFormat), now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("soon", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("", now))
+}
+
+func TestCountryRetries(t *testing.T) {
+	var calls atomic.Int64
+	var responses chan func(w http.ResponseWriter)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		(<-responses)(w)
+	}))
+	defer server.Close()
+	status := func(code int, retryAfter string) func(w http.ResponseWriter) {
+		return func(w http.ResponseWriter) {
+			if retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			w.WriteHeader(code)
+		}
+	}
+	found := func(w http.ResponseWriter) {
+		fmt.Fprint(w, `{"country_code": "US"}`)
+	}
+	m := &Country{
+		LookupURLFormat: server.URL + "/%s",
+		Client:          &http.Client{},
+		Breaker:         &Breaker{FailureThreshold: 3, SuccessThreshold: 1, OpenTimeout: time.Hour},
+		Retry:           RetryPolicy{Attempts: 3, Backoff: time.Millisecond, MaxBackoff: 2 * time.Second},
+	}
+	lookup := func(t *testing.T, results ...func(w http.ResponseWriter)) (string, error) {
+		responses = make(chan func(w http.ResponseWriter), len(results))
+		for _, r := range results {
+			responses <- r
+		}
+		calls.Store(0)
+		return m.country(context.Background(), "1.1.1.1")
+	}
+
+	t.Run("service failures are retried", func(t *testing.T) {
+		country, err := lookup(t, status(http.StatusBadGateway, ""), status(http.StatusTooManyRequests, "1"), found)
+		require.NoError(t, err)
+		assert.Equal(t, "US", country)
+		assert.Equal(t, int64(3), calls.Load())
+		assert.Equal(t, int64(2), m.Stats().Retries)
+	})
+
+	t.Run("bad requests are not retried", func(t *testing.T) {
+		_, err := lookup(t, status(http.StatusBadRequest, ""))
+		assert.Error(t, err)
+		assert.Equal(t, int64(1), calls.Load())
+	})
+
+	t.Run("too long Retry-After", func(t *testing.T) {
+		_, err := lookup(t, status(http.StatusTooManyRequests, "60"))
+		assert.Error(t, err)
+		assert.Equal(t, int64(1), calls.Load())
+	})
+
+	t.Run("breaker", func(t *testing.T) {
+		// the previous failure counts as well
+		_, err := lookup(t, status(http.StatusServiceUnavailable, ""), status(http.StatusServiceUnavailable, ""))
+		assert.Equal(t, ErrBreakerOpen, err)
+		assert.Equal(t, int64(2), calls.Load())
+		assert.Equal(t, ErrBreakerOpen, m.Healthy())
+		assert.Equal(t, "open", m.Stats().Breaker.State)
+	})
+}
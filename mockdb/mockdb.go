@@ -5,20 +5,23 @@ import (
 	"context"
 	"errors"
 	"sync"
+	"time"
 
 	"github.com/irmatov/companies/filter"
 	"github.com/irmatov/companies/types"
 )
 
 type mockStorage struct {
-	mutex sync.Mutex
-	data  []types.Company
-	seq   int
+	mutex     sync.Mutex
+	data      []types.Company
+	seq       int
+	responses map[string]types.Response
 }
 
 type mockTx struct {
-	data []types.Company
-	seq  int
+	data      []types.Company
+	seq       int
+	responses map[string]types.Response
 }
 
 func New() types.Storage {
@@ -28,21 +31,25 @@ func New() types.Storage {
 func (m *mockStorage) Tx(ctx context.Context, action func(types.Tx) error) error {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
-	tx := &mockTx{data: make([]types.Company, len(m.data)), seq: m.seq}
+	tx := &mockTx{data: make([]types.Company, len(m.data)), seq: m.seq, responses: make(map[string]types.Response, len(m.responses))}
 	copy(tx.data, m.data)
+	for k, r := range m.responses {
+		tx.responses[k] = r
+	}
 	err := action(tx)
 	if err != nil {
 		return err
 	}
 	m.data = tx.data
 	m.seq = tx.seq
+	m.responses = tx.responses
 	return nil
 }
 
 func (tx *mockTx) Get(f filter.Filter) ([]types.Company, error) {
 	switch f.Expr {
 	case "":
-		return tx.data, nil
+		return append([]types.Company(nil), tx.data...), nil
 	case "id = $1":
 		id := f.Arguments[0].(int)
 		for _, c := range tx.data {
@@ -63,6 +70,19 @@ func (tx *mockTx) Get(f filter.Filter) ([]types.Company, error) {
 	return nil, nil
 }
 
+func (tx *mockTx) Iterate(f filter.Filter, fn func(types.Company) error) error {
+	companies, err := tx.Get(f)
+	if err != nil {
+		return err
+	}
+	for _, c := range companies {
+		if err := fn(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (tx *mockTx) Create(newCompany types.Company) (int, error) {
 	tx.seq++
 	for _, c := range tx.data {
@@ -71,6 +91,8 @@ func (tx *mockTx) Create(newCompany types.Company) (int, error) {
 		}
 	}
 	newCompany.Id = tx.seq
+	newCompany.Version = 1
+	newCompany.UpdatedAt = time.Now().UTC()
 	tx.data = append(tx.data, newCompany)
 	return tx.seq, nil
 }
@@ -78,6 +100,11 @@ func (tx *mockTx) Create(newCompany types.Company) (int, error) {
 func (tx *mockTx) Update(c types.Company) error {
 	for i, existing := range tx.data {
 		if existing.Id == c.Id {
+			if existing.Version != c.Version {
+				return types.ErrVersionMismatch
+			}
+			c.Version++
+			c.UpdatedAt = time.Now().UTC()
 			tx.data[i] = c
 			return nil
 		}
@@ -85,12 +112,53 @@ func (tx *mockTx) Update(c types.Company) error {
 	return errors.New("not found")
 }
 
-func (tx *mockTx) Delete(id int) error {
+func (tx *mockTx) Delete(id int, version int) error {
 	for i, c := range tx.data {
 		if c.Id == id {
+			if version != 0 && c.Version != version {
+				return types.ErrVersionMismatch
+			}
 			tx.data = append(tx.data[:i], tx.data[i+1:]...)
 			return nil
 		}
 	}
 	return errors.New("not found")
 }
+
+func (tx *mockTx) GetResponse(key string) (types.Response, error) {
+	r, ok := tx.responses[key]
+	if !ok {
+		return types.Response{}, types.ErrNotFound
+	}
+	return r, nil
+}
+
+func (tx *mockTx) CreateResponse(r types.Response) error {
+	if _, ok := tx.responses[r.Key]; ok {
+		return types.ErrAlreadyExists
+	}
+	tx.responses[r.Key] = r
+	return nil
+}
+
+func (tx *mockTx) UpdateResponse(r types.Response) error {
+	if existing, ok := tx.responses[r.Key]; ok {
+		existing.Status, existing.ContentType, existing.Body = r.Status, r.ContentType, r.Body
+		tx.responses[r.Key] = existing
+	}
+	return nil
+}
+
+func (tx *mockTx) DeleteResponse(key string) error {
+	delete(tx.responses, key)
+	return nil
+}
+
+func (tx *mockTx) ExpireResponses(before time.Time) error {
+	for k, r := range tx.responses {
+		if r.CreatedAt.Before(before) {
+			delete(tx.responses, k)
+		}
+	}
+	return nil
+}
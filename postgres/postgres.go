@@ -5,6 +5,7 @@ import (
 	"context"
 	"database/sql"
 	"log"
+	"time"
 
 	"github.com/irmatov/companies/filter"
 	"github.com/irmatov/companies/types"
@@ -41,7 +42,20 @@ func (p *postgres) Tx(ctx context.Context, action func(types.Tx) error) error {
 
 // Get returns a list of companies that match the given filter.
 func (tx *wrappedTx) Get(f filter.Filter) ([]types.Company, error) {
-	q := `SELECT id, name, code, country, website, phone FROM companies`
+	companies := make([]types.Company, 0)
+	err := tx.Iterate(f, func(c types.Company) error {
+		companies = append(companies, c)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return companies, nil
+}
+
+// Iterate calls fn for each company that matches the given filter, reading them one by one.
+func (tx *wrappedTx) Iterate(f filter.Filter, fn func(types.Company) error) error {
+	q := `SELECT id, name, code, country, website, phone, version, updated_at FROM companies`
 	if f.Expr != "" {
 		q += ` WHERE ` + f.Expr
 	}
@@ -49,27 +63,25 @@ func (tx *wrappedTx) Get(f filter.Filter) ([]types.Company, error) {
 	log.Printf("query: %s", q)
 	rows, err := tx.tx.Query(q, f.Arguments...)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	companies := make([]types.Company, 0)
+	defer rows.Close()
 	for rows.Next() {
 		var c types.Company
-		err := rows.Scan(&c.Id, &c.Name, &c.Code, &c.Country, &c.Website, &c.Phone)
+		err := rows.Scan(&c.Id, &c.Name, &c.Code, &c.Country, &c.Website, &c.Phone, &c.Version, &c.UpdatedAt)
 		if err != nil {
-			rows.Close()
-			return nil, err
+			return err
+		}
+		if err := fn(c); err != nil {
+			return err
 		}
-		companies = append(companies, c)
-	}
-	if err := rows.Err(); err != nil {
-		return nil, err
 	}
-	return companies, nil
+	return rows.Err()
 }
 
 // Create creates a new company and returns its ID.
 func (tx *wrappedTx) Create(c types.Company) (int, error) {
-	const q = `INSERT INTO companies (name, code, country, website, phone) VALUES ($1, $2, $3, $4, $5) RETURNING id`
+	const q = `INSERT INTO companies (name, code, country, website, phone, version) VALUES ($1, $2, $3, $4, $5, 1) RETURNING id`
 	row := tx.tx.QueryRow(q, c.Name, c.Code, c.Country, c.Website, c.Phone)
 	if err := row.Scan(&c.Id); err != nil {
 		return 0, err
@@ -77,14 +89,91 @@ func (tx *wrappedTx) Create(c types.Company) (int, error) {
 	return c.Id, nil
 }
 
-// Update updates the company with the given ID.
+// Update updates the company with the given ID and version, incrementing the version
+// and refreshing the modification time.
+// types.ErrVersionMismatch is returned if the company has been changed in the meantime.
 func (tx *wrappedTx) Update(c types.Company) error {
-	_, err := tx.tx.Exec(`UPDATE companies SET name = $1, code = $2, country = $3, website = $4, phone = $5 WHERE id = $6`, c.Name, c.Code, c.Country, c.Website, c.Phone, c.Id)
+	res, err := tx.tx.Exec(`UPDATE companies SET name = $1, code = $2, country = $3, website = $4, phone = $5, version = version + 1, updated_at = now() WHERE id = $6 AND version = $7`, c.Name, c.Code, c.Country, c.Website, c.Phone, c.Id, c.Version)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return types.ErrVersionMismatch
+	}
+	return nil
+}
+
+// Delete deletes the company with the given ID and version, any version if it is zero.
+// types.ErrVersionMismatch is returned if the company has been changed in the meantime,
+// types.ErrNotFound if it has been deleted.
+func (tx *wrappedTx) Delete(id int, version int) error {
+	res, err := tx.tx.Exec(`DELETE FROM companies WHERE id = $1 AND ($2 = 0 OR version = $2)`, id, version)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+	var exists bool
+	if err := tx.tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM companies WHERE id = $1)`, id).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return types.ErrVersionMismatch
+	}
+	return types.ErrNotFound
+}
+
+// GetResponse returns the response stored for the idempotency key.
+func (tx *wrappedTx) GetResponse(key string) (types.Response, error) {
+	r := types.Response{Key: key}
+	const q = `SELECT fingerprint, status, content_type, body, created_at FROM idempotency_keys WHERE key = $1`
+	err := tx.tx.QueryRow(q, key).Scan(&r.Fingerprint, &r.Status, &r.ContentType, &r.Body, &r.CreatedAt)
+	if err == sql.ErrNoRows {
+		return types.Response{}, types.ErrNotFound
+	}
+	return r, err
+}
+
+// CreateResponse stores a response for a new idempotency key.
+func (tx *wrappedTx) CreateResponse(r types.Response) error {
+	const q = `INSERT INTO idempotency_keys (key, fingerprint, status, content_type, body, created_at) VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (key) DO NOTHING`
+	res, err := tx.tx.Exec(q, r.Key, r.Fingerprint, r.Status, r.ContentType, r.Body, r.CreatedAt)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return types.ErrAlreadyExists
+	}
+	return nil
+}
+
+// UpdateResponse replaces the response stored for the idempotency key.
+func (tx *wrappedTx) UpdateResponse(r types.Response) error {
+	_, err := tx.tx.Exec(`UPDATE idempotency_keys SET status = $1, content_type = $2, body = $3 WHERE key = $4`, r.Status, r.ContentType, r.Body, r.Key)
+	return err
+}
+
+// DeleteResponse deletes the response stored for the idempotency key.
+func (tx *wrappedTx) DeleteResponse(key string) error {
+	_, err := tx.tx.Exec(`DELETE FROM idempotency_keys WHERE key = $1`, key)
 	return err
 }
 
-// Delete deletes the company with the given ID.
-func (tx *wrappedTx) Delete(id int) error {
-	_, err := tx.tx.Exec(`DELETE FROM companies WHERE id = $1`, id)
+// ExpireResponses deletes the responses created before the given time.
+func (tx *wrappedTx) ExpireResponses(before time.Time) error {
+	_, err := tx.tx.Exec(`DELETE FROM idempotency_keys WHERE created_at < $1`, before)
 	return err
 }
@@ -0,0 +1,131 @@
+// Package problem implements problem details for HTTP APIs as described by RFC 7807.
+// Every problem carries a stable machine readable code, which is also a part of its type URI.
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// ContentType is the media type of problem details documents.
+const ContentType = "application/problem+json"
+
+// TypePrefix is prepended to problem codes to build problem type URIs.
+const TypePrefix = "urn:problem-type:companies:"
+
+// Code identifies a kind of problem. Codes are a part of the API and must not be changed.
+type Code string
+
+const (
+	CodeInternal              Code = "internal"
+	CodeInvalidId             Code = "invalid_id"
+	CodeInvalidContentType    Code = "invalid_content_type"
+	CodeInvalidJson           Code = "invalid_json"
+	CodeInvalidCsv            Code = "invalid_csv"
+	CodeInvalidFilter         Code = "invalid_filter"
+	CodeInvalidParameter      Code = "invalid_parameter"
+	CodeValidationFailed      Code = "validation_failed"
+	CodeIdMismatch            Code = "id_mismatch"
+	CodeNotFound              Code = "not_found"
+	CodeAlreadyExists         Code = "already_exists"
+	CodePreconditionFailed    Code = "precondition_failed"
+	CodeNotAcceptable         Code = "not_acceptable"
+	CodeTooManyOperations     Code = "too_many_operations"
+	CodeUnknownOperation      Code = "unknown_operation"
+	CodeAborted               Code = "aborted"
+	CodeForbidden             Code = "forbidden"
+	CodeInvalidIdempotencyKey Code = "invalid_idempotency_key"
+	CodeIdempotencyKeyReused  Code = "idempotency_key_reused"
+	CodeRequestInProgress     Code = "request_in_progress"
+	CodeUnavailable           Code = "unavailable"
+	CodeMethodNotAllowed      Code = "method_not_allowed"
+)
+
+var titles = map[Code]string{
+	CodeInternal:              "Internal server error",
+	CodeInvalidId:             "Invalid company identifier",
+	CodeInvalidContentType:    "Unsupported content type",
+	CodeInvalidJson:           "Malformed JSON",
+	CodeInvalidCsv:            "Malformed CSV",
+	CodeInvalidFilter:         "Invalid filter expression",
+	CodeInvalidParameter:      "Invalid query parameter",
+	CodeValidationFailed:      "Validation failed",
+	CodeIdMismatch:            "Company identifier mismatch",
+	CodeNotFound:              "Company not found",
+	CodeAlreadyExists:         "Company already exists",
+	CodePreconditionFailed:    "Precondition failed",
+	CodeNotAcceptable:         "No acceptable representation",
+	CodeTooManyOperations:     "Too many operations",
+	CodeUnknownOperation:      "Unknown operation",
+	CodeAborted:               "Operation aborted",
+	CodeForbidden:             "Access denied",
+	CodeInvalidIdempotencyKey: "Invalid idempotency key",
+	CodeIdempotencyKeyReused:  "Idempotency key reused",
+	CodeRequestInProgress:     "Request in progress",
+	CodeUnavailable:           "Service unavailable",
+	CodeMethodNotAllowed:      "Method not allowed",
+}
+
+// FieldError describes a problem with a single field of a request.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    Code   `json:"code"`
+	Message string `json:"message"`
+}
+
+// Problem is a problem details document.
+type Problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Code     Code         `json:"code"`
+	Errors   []FieldError `json:"errors,omitempty"`
+}
+
+// New creates a problem of the given kind. The detail is a human readable explanation
+// specific to this occurrence of the problem and may be empty.
+func New(status int, code Code, detail string) *Problem {
+	title, ok := titles[code]
+	if !ok {
+		title = http.StatusText(status)
+	}
+	return &Problem{
+		Type:   TypePrefix + string(code),
+		Title:  title,
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// WithErrors adds field errors to the problem and returns it.
+func (p *Problem) WithErrors(errs ...FieldError) *Problem {
+	p.Errors = append(p.Errors, errs...)
+	return p
+}
+
+// Error implements error interface.
+func (p *Problem) Error() string {
+	if p.Detail != "" {
+		return p.Title + ": " + p.Detail
+	}
+	return p.Title
+}
+
+// Write writes the problem as a response to the request. The request path is used
+// as the problem instance unless one is already set.
+func (p *Problem) Write(w http.ResponseWriter, r *http.Request) {
+	if p.Instance == "" && r != nil {
+		p.Instance = r.URL.Path
+	}
+	b, err := json.Marshal(p)
+	if err != nil {
+		// should be logged/ handled somehow in production
+		panic(err)
+	}
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(p.Status)
+	w.Write(b)
+}
@@ -0,0 +1,29 @@
+package problem
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWrite(t *testing.T) {
+	req := httptest.NewRequest("POST", "/companies/", nil)
+	w := httptest.NewRecorder()
+	New(http.StatusBadRequest, CodeValidationFailed, "").WithErrors(FieldError{
+		Field:   "name",
+		Code:    "required",
+		Message: "name is required",
+	}).Write(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, ContentType, w.Result().Header.Get("Content-Type"))
+	assert.JSONEq(t, `{
+		"type": "urn:problem-type:companies:validation_failed",
+		"title": "Validation failed",
+		"status": 400,
+		"instance": "/companies/",
+		"code": "validation_failed",
+		"errors": [{"field": "name", "code": "required", "message": "name is required"}]
+	}`, w.Body.String())
+}
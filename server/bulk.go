@@ -0,0 +1,109 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/irmatov/companies/problem"
+	"github.com/irmatov/companies/service"
+	"github.com/irmatov/companies/types"
+	"github.com/julienschmidt/httprouter"
+)
+
+const maxBulkOperations = 10000
+
+// bulk will handle POST requests to /companies/_bulk. The body is an array of
+// operations, the response is an array of their outcomes in the same order.
+// By default the operations are applied atomically, mode=independent query
+// parameter makes each of them to be applied on its own.
+func (s *server) bulk(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	if r.Header.Get("Content-Type") != "application/json" {
+		writeProblem(w, r, http.StatusBadRequest, problem.CodeInvalidContentType, "")
+		return
+	}
+	var atomic bool
+	switch r.FormValue("mode") {
+	case "", "atomic":
+		atomic = true
+	case "independent":
+	default:
+		writeProblem(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "invalid mode")
+		return
+	}
+	var req []bulkOperation
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, problem.CodeInvalidJson, "")
+		return
+	}
+	if len(req) > maxBulkOperations {
+		writeProblem(w, r, http.StatusRequestEntityTooLarge, problem.CodeTooManyOperations, fmt.Sprintf("at most %d operations are allowed", maxBulkOperations))
+		return
+	}
+
+	results := make([]bulkResult, len(req))
+	ops := make([]service.Operation, 0, len(req))
+	index := make([]int, 0, len(req)) // maps ops to results
+	for i, op := range req {
+		o, p := op.operation()
+		if p != nil {
+			results[i] = bulkResult{Status: p.Status, Error: p}
+			continue
+		}
+		ops = append(ops, o)
+		index = append(index, i)
+	}
+	if atomic && len(ops) != len(req) {
+		for i := range results {
+			if results[i].Status == 0 {
+				p := serviceError(types.ErrAborted)
+				results[i] = bulkResult{Status: p.Status, Error: p}
+			}
+		}
+		writeJson(w, http.StatusOK, s.wire(results))
+		return
+	}
+
+	outcomes, err := s.svc.Bulk(r.Context(), ops, atomic)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	for i, outcome := range outcomes {
+		result := &results[index[i]]
+		if outcome.Err != nil {
+			p := serviceError(outcome.Err)
+			*result = bulkResult{Status: p.Status, Error: p}
+			continue
+		}
+		switch ops[i].Kind {
+		case service.OpCreate:
+			*result = bulkResult{Status: http.StatusCreated, Id: outcome.Id}
+		default:
+			*result = bulkResult{Status: http.StatusNoContent}
+		}
+	}
+	writeJson(w, http.StatusOK, s.wire(results))
+}
+
+// operation checks the requested operation the same way the corresponding
+// single company handler does and converts it for the service, which rejects
+// unknown operation kinds.
+func (op bulkOperation) operation() (service.Operation, *problem.Problem) {
+	c := op.Company.domain()
+	switch service.OperationKind(op.Op) {
+	case service.OpUpdate:
+		if c.Id == 0 {
+			c.Id = op.Id
+		}
+		if c.Id != op.Id {
+			return service.Operation{}, problem.New(http.StatusBadRequest, problem.CodeIdMismatch, errIdMismatch.Error())
+		}
+	case service.OpDelete:
+		c = types.Company{Id: op.Id}
+	}
+	if op.Version != 0 {
+		c.Version = op.Version
+	}
+	return service.Operation{Kind: service.OperationKind(op.Op), Company: c}, nil
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/irmatov/companies/mockdb"
+	"github.com/irmatov/companies/problem"
+	"github.com/irmatov/companies/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerBulk(t *testing.T) {
+	server := New(mockdb.New())
+	c1 := types.Company{
+		Name:    "First Company",
+		Code:    "FIRST",
+		Country: "GB",
+		Website: "https://first.com/",
+		Phone:   "+111",
+	}
+	c2 := types.Company{
+		Name:    "Second Company",
+		Code:    "SECOND",
+		Country: "FR",
+		Website: "https://second.com/",
+		Phone:   "+222",
+	}
+
+	bulk := func(t *testing.T, mode string, ops []bulkOperation) []bulkResult {
+		b, err := json.Marshal(ops)
+		require.NoError(t, err)
+		req := httptest.NewRequest("POST", baseURL+"_bulk?mode="+mode, bytes.NewBuffer(b))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		var r []bulkResult
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &r))
+		return r
+	}
+
+	t.Run("atomic create", func(t *testing.T) {
+		r := bulk(t, "atomic", []bulkOperation{
+			{Op: "create", Company: newCompany(c1)},
+			{Op: "create", Company: newCompany(c2)},
+		})
+		assert.Equal(t, []bulkResult{{Status: http.StatusCreated, Id: 1}, {Status: http.StatusCreated, Id: 2}}, r)
+		c1.Id, c2.Id = 1, 2
+	})
+
+	t.Run("atomic failure is rolled back", func(t *testing.T) {
+		c3 := c1
+		c3.Name = "Third Company"
+		r := bulk(t, "atomic", []bulkOperation{
+			{Op: "create", Company: newCompany(c3)},
+			{Op: "delete", Id: 999},
+		})
+		assert.Equal(t, http.StatusFailedDependency, r[0].Status)
+		assert.Equal(t, http.StatusNotFound, r[1].Status)
+		assert.Len(t, testGetCompanies(t, server), 2)
+	})
+
+	t.Run("invalid operation aborts atomic request", func(t *testing.T) {
+		r := bulk(t, "", []bulkOperation{
+			{Op: "delete", Id: c2.Id},
+			{Op: "create", Company: company{Name: " spaces "}},
+			{Op: "rename", Id: c1.Id},
+		})
+		assert.Equal(t, http.StatusFailedDependency, r[0].Status)
+		assert.Equal(t, http.StatusBadRequest, r[1].Status)
+		assert.Equal(t, http.StatusBadRequest, r[2].Status)
+		require.NotNil(t, r[2].Error)
+		assert.Equal(t, problem.CodeUnknownOperation, r[2].Error.Code)
+		assert.Len(t, testGetCompanies(t, server), 2)
+	})
+
+	t.Run("independent operations", func(t *testing.T) {
+		c1.Phone = "+1111"
+		dup := c2
+		dup.Code = "OTHER"
+		r := bulk(t, "independent", []bulkOperation{
+			{Op: "update", Id: c1.Id, Company: newCompany(c1)},
+			{Op: "create", Company: newCompany(dup)},
+			{Op: "delete", Id: c2.Id, Version: 5},
+			{Op: "delete", Id: c2.Id},
+		})
+		assert.Equal(t, []int{http.StatusNoContent, http.StatusConflict, http.StatusPreconditionFailed, http.StatusNoContent},
+			[]int{r[0].Status, r[1].Status, r[2].Status, r[3].Status})
+		c1.Version = 2
+		assert.Equal(t, []types.Company{c1}, testGetCompanies(t, server))
+	})
+}
@@ -7,8 +7,11 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/irmatov/companies/filter"
+	"github.com/irmatov/companies/mockdb"
+	"github.com/irmatov/companies/problem"
 	"github.com/irmatov/companies/types"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -34,10 +37,12 @@ func TestServerCreate(t *testing.T) {
 		w := httptest.NewRecorder()
 		server.ServeHTTP(w, req)
 		assert.Equal(t, http.StatusBadRequest, w.Code)
-		assert.Equal(t, w.Result().Header.Get("Content-Type"), "application/json")
-		var r genericError
+		assert.Equal(t, w.Result().Header.Get("Content-Type"), problem.ContentType)
+		var r problem.Problem
 		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &r))
-		assert.Equal(t, "invalid Content-Type", r.Error)
+		assert.Equal(t, problem.CodeInvalidContentType, r.Code)
+		assert.Equal(t, http.StatusBadRequest, r.Status)
+		assert.Equal(t, "/companies/", r.Instance)
 	})
 
 	t.Run("first create", func(t *testing.T) {
@@ -88,9 +93,29 @@ func TestServerCreate(t *testing.T) {
 		_ = db.Tx(context.Background(), func(tx types.Tx) error {
 			got, err := tx.Get(filter.Filter{})
 			require.NoError(t, err)
+			require.Len(t, got, 1)
+			got[0].UpdatedAt = time.Time{}
 			c1.Id = 1
+			c1.Version = 1
 			require.Equal(t, []types.Company{c1}, got)
 			return nil
 		})
 	})
 }
+
+func TestServerCreateValidation(t *testing.T) {
+	server := New(mockdb.New())
+	req := httptest.NewRequest("POST", "/companies/", bytes.NewBufferString(`{"Name": "Invalid", "Code": "INV", "Country": "XX", "Phone": "12345"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var r problem.Problem
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &r))
+	assert.Equal(t, problem.CodeValidationFailed, r.Code)
+	var fields []string
+	for _, fe := range r.Errors {
+		fields = append(fields, fe.Field)
+	}
+	assert.Equal(t, []string{"country", "phone"}, fields)
+}
@@ -4,23 +4,23 @@ import (
 	"net/http"
 	"strconv"
 
-	"github.com/irmatov/companies/types"
+	"github.com/irmatov/companies/problem"
 	"github.com/julienschmidt/httprouter"
 )
 
 func (s *server) delete(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	id, err := strconv.Atoi(ps.ByName("id"))
 	if err != nil {
-		writeJson(w, http.StatusBadRequest, genericError{err.Error()})
+		writeProblem(w, r, http.StatusBadRequest, problem.CodeInvalidId, "company id must be an integer")
 		return
 	}
-	err = s.svc.Delete(r.Context(), id)
-	if err != nil {
-		if err == types.ErrNotFound {
-			writeJson(w, http.StatusNotFound, genericError{err.Error()})
-			return
-		}
-		writeJson(w, http.StatusInternalServerError, genericError{"internal server error"})
+	version, ok := ifMatchVersion(r)
+	if !ok {
+		writeProblem(w, r, http.StatusPreconditionFailed, problem.CodePreconditionFailed, "If-Match does not match any version")
+		return
+	}
+	if err := s.svc.Delete(r.Context(), id, version); err != nil {
+		writeError(w, r, err)
 		return
 	}
 	writeJson(w, http.StatusNoContent, nil)
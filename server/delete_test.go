@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -18,11 +19,12 @@ func TestServerDelete(t *testing.T) {
 	c1 := types.Company{
 		Name:    "First Company",
 		Code:    "FIRST",
-		Country: "UK",
+		Country: "GB",
 		Website: "https://first.com/",
 		Phone:   "+111",
 	}
 	c1.Id = testCreateCompany(t, server, c1)
+	c1.Version = 1
 
 	c2 := types.Company{
 		Name:    "Second Company",
@@ -32,6 +34,7 @@ func TestServerDelete(t *testing.T) {
 		Phone:   "+222",
 	}
 	c2.Id = testCreateCompany(t, server, c2)
+	c2.Version = 1
 
 	c3 := types.Company{
 		Name:    "Third Company",
@@ -41,6 +44,7 @@ func TestServerDelete(t *testing.T) {
 		Phone:   "+333",
 	}
 	c3.Id = testCreateCompany(t, server, c3)
+	c3.Version = 1
 
 	t.Run("get all companies", func(t *testing.T) {
 		req := httptest.NewRequest("GET", baseURL, nil)
@@ -53,6 +57,25 @@ func TestServerDelete(t *testing.T) {
 		assert.Equal(t, []types.Company{c1, c2, c3}, r)
 	})
 
+	t.Run("storage checks the version", func(t *testing.T) {
+		err := db.Tx(context.Background(), func(tx types.Tx) error {
+			return tx.Delete(c3.Id, 2)
+		})
+		assert.Equal(t, types.ErrVersionMismatch, err)
+		err = db.Tx(context.Background(), func(tx types.Tx) error {
+			return tx.Delete(999, 1)
+		})
+		assert.Equal(t, types.ErrNotFound, err)
+	})
+
+	t.Run("delete with stale If-Match", func(t *testing.T) {
+		req := httptest.NewRequest("DELETE", fmt.Sprintf("/companies/%d", c3.Id), nil)
+		req.Header.Set("If-Match", `"2"`)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	})
+
 	t.Run("delete last one", func(t *testing.T) {
 		req := httptest.NewRequest("DELETE", fmt.Sprintf("/companies/%d", c3.Id), nil)
 		w := httptest.NewRecorder()
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/irmatov/companies/types"
+)
+
+// etag returns a strong entity tag for the given company version.
+func etag(version int) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// ifMatchVersion extracts the expected company version from the If-Match header.
+// Zero version is returned if the header is absent or is "*", meaning any version
+// is acceptable. ok is false if the header can not match any version, e.g. it is
+// malformed or contains a weak entity tag.
+func ifMatchVersion(r *http.Request) (version int, ok bool) {
+	h := strings.TrimSpace(r.Header.Get("If-Match"))
+	if h == "" || h == "*" {
+		return 0, true
+	}
+	if len(h) < 2 || h[0] != '"' || h[len(h)-1] != '"' {
+		return 0, false
+	}
+	version, err := strconv.Atoi(h[1 : len(h)-1])
+	if err != nil || version <= 0 {
+		return 0, false
+	}
+	return version, true
+}
+
+// collectionETag returns a strong entity tag for a list of companies in the given
+// format. It changes whenever a company is added to, removed from or modified
+// within the list.
+func collectionETag(format string, companies []types.Company) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s;", format)
+	for _, c := range companies {
+		fmt.Fprintf(h, "%d:%d;", c.Id, c.Version)
+	}
+	return fmt.Sprintf(`"%x"`, h.Sum(nil)[:16])
+}
+
+// notModified sets validator headers for the representation and reports whether
+// the request conditions allow replying with 304 Not Modified. If-Modified-Since
+// is only considered in absence of If-None-Match and if modTime is known.
+func notModified(w http.ResponseWriter, r *http.Request, tag string, modTime time.Time) bool {
+	w.Header().Set("ETag", tag)
+	if !modTime.IsZero() {
+		w.Header().Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == tag {
+				return true
+			}
+		}
+		return false
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && !modTime.IsZero() {
+		t, err := http.ParseTime(ims)
+		if err != nil {
+			return false
+		}
+		return !modTime.Truncate(time.Second).After(t)
+	}
+	return false
+}
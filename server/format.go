@@ -0,0 +1,224 @@
+package server
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/irmatov/companies/companycsv"
+	"github.com/irmatov/companies/types"
+)
+
+// companyEncoder writes a list of companies in a particular format.
+type companyEncoder interface {
+	Encode(c types.Company) error
+	// Close finishes the list, it must be called even if nothing has been encoded.
+	Close() error
+}
+
+// format describes a representation of company lists.
+type format struct {
+	name        string
+	contentType string
+	mediaTypes  []string // accepted in the Accept header
+	// newEncoder creates an encoder, wire returns the JSON representation of a company.
+	newEncoder func(w io.Writer, wire func(types.Company) interface{}) companyEncoder
+}
+
+var formats = []format{
+	{"json", "application/json", []string{"application/json"}, newJsonEncoder},
+	{"csv", "text/csv; charset=utf-8", []string{"text/csv"}, newCsvEncoder},
+	{"ndjson", "application/x-ndjson", []string{"application/x-ndjson"}, newNdjsonEncoder},
+	{"xml", "application/xml; charset=utf-8", []string{"application/xml", "text/xml"}, newXmlEncoder},
+}
+
+// negotiateFormat selects the list representation. The format query parameter takes
+// precedence over the Accept header, JSON is used if neither is present. ok is false
+// if there is no acceptable format.
+func negotiateFormat(r *http.Request) (f format, ok bool) {
+	if name := r.URL.Query().Get("format"); name != "" {
+		for _, f := range formats {
+			if f.name == name {
+				return f, true
+			}
+		}
+		return format{}, false
+	}
+	accept := r.Header.Get("Accept")
+	if strings.TrimSpace(accept) == "" {
+		return formats[0], true
+	}
+
+	type mediaRange struct {
+		mediaType string
+		q         float64
+	}
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		ranges = append(ranges, mediaRange{mt, q})
+	}
+	// more specific ranges take precedence over wildcards with the same quality
+	sort.SliceStable(ranges, func(i, j int) bool {
+		if ranges[i].q != ranges[j].q {
+			return ranges[i].q > ranges[j].q
+		}
+		return strings.Count(ranges[i].mediaType, "*") < strings.Count(ranges[j].mediaType, "*")
+	})
+	for _, mr := range ranges {
+		if mr.q <= 0 {
+			break
+		}
+		for _, f := range formats {
+			for _, mt := range f.mediaTypes {
+				if mediaTypeMatches(mr.mediaType, mt) {
+					return f, true
+				}
+			}
+		}
+	}
+	return format{}, false
+}
+
+func mediaTypeMatches(pattern, mediaType string) bool {
+	if pattern == "*/*" || pattern == mediaType {
+		return true
+	}
+	return strings.HasSuffix(pattern, "/*") && strings.HasPrefix(mediaType, pattern[:len(pattern)-1])
+}
+
+type jsonEncoder struct {
+	w     io.Writer
+	wire  func(types.Company) interface{}
+	count int
+}
+
+func newJsonEncoder(w io.Writer, wire func(types.Company) interface{}) companyEncoder {
+	return &jsonEncoder{w: w, wire: wire}
+}
+
+func (e *jsonEncoder) Encode(c types.Company) error {
+	b, err := json.Marshal(e.wire(c))
+	if err != nil {
+		return err
+	}
+	sep := ","
+	if e.count == 0 {
+		sep = "["
+	}
+	e.count++
+	if _, err := io.WriteString(e.w, sep); err != nil {
+		return err
+	}
+	_, err = e.w.Write(b)
+	return err
+}
+
+func (e *jsonEncoder) Close() error {
+	end := "]"
+	if e.count == 0 {
+		end = "[]"
+	}
+	_, err := io.WriteString(e.w, end)
+	return err
+}
+
+type ndjsonEncoder struct {
+	enc  *json.Encoder
+	wire func(types.Company) interface{}
+}
+
+func newNdjsonEncoder(w io.Writer, wire func(types.Company) interface{}) companyEncoder {
+	return ndjsonEncoder{json.NewEncoder(w), wire}
+}
+
+func (e ndjsonEncoder) Encode(c types.Company) error {
+	return e.enc.Encode(e.wire(c))
+}
+
+func (e ndjsonEncoder) Close() error {
+	return nil
+}
+
+type csvEncoder struct {
+	w *companycsv.Writer
+}
+
+func newCsvEncoder(w io.Writer, _ func(types.Company) interface{}) companyEncoder {
+	return csvEncoder{companycsv.NewWriter(w)}
+}
+
+func (e csvEncoder) Encode(c types.Company) error {
+	return e.w.Write(c)
+}
+
+func (e csvEncoder) Close() error {
+	return e.w.Flush()
+}
+
+type xmlCompany struct {
+	XMLName xml.Name `xml:"company"`
+	Id      int      `xml:"id"`
+	Name    string   `xml:"name"`
+	Code    string   `xml:"code"`
+	Country string   `xml:"country"`
+	Website string   `xml:"website"`
+	Phone   string   `xml:"phone"`
+	Version int      `xml:"version"`
+}
+
+type xmlEncoder struct {
+	w       io.Writer
+	enc     *xml.Encoder
+	started bool
+}
+
+func newXmlEncoder(w io.Writer, _ func(types.Company) interface{}) companyEncoder {
+	return &xmlEncoder{w: w, enc: xml.NewEncoder(w)}
+}
+
+func (e *xmlEncoder) start() error {
+	if e.started {
+		return nil
+	}
+	e.started = true
+	_, err := io.WriteString(e.w, xml.Header+"<companies>")
+	return err
+}
+
+func (e *xmlEncoder) Encode(c types.Company) error {
+	if err := e.start(); err != nil {
+		return err
+	}
+	return e.enc.Encode(xmlCompany{
+		Id:      c.Id,
+		Name:    c.Name,
+		Code:    c.Code,
+		Country: c.Country,
+		Website: c.Website,
+		Phone:   c.Phone,
+		Version: c.Version,
+	})
+}
+
+func (e *xmlEncoder) Close() error {
+	if err := e.start(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(e.w, "</companies>")
+	return err
+}
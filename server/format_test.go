@@ -0,0 +1,107 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/irmatov/companies/mockdb"
+	"github.com/irmatov/companies/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		accept string
+		want   string
+	}{
+		{"no preference", "", "", "json"},
+		{"anything", "", "*/*", "json"},
+		{"csv", "", "text/csv", "csv"},
+		{"text wildcard", "", "text/*", "csv"},
+		{"xml alias", "", "text/xml", "xml"},
+		{"quality", "", "application/json;q=0.5, application/x-ndjson", "ndjson"},
+		{"specific before wildcard", "", "*/*, application/xml", "xml"},
+		{"unsupported skipped", "", "text/html, application/json;q=0.1", "json"},
+		{"explicitly refused", "", "application/json;q=0", ""},
+		{"unsupported", "", "text/html", ""},
+		{"query overrides header", "?format=csv", "application/json", "csv"},
+		{"unknown query format", "?format=yaml", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", baseURL+tt.query, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			got, ok := negotiateFormat(req)
+			assert.Equal(t, tt.want != "", ok)
+			assert.Equal(t, tt.want, got.name)
+		})
+	}
+}
+
+func TestServerGetFormats(t *testing.T) {
+	server := New(mockdb.New())
+	testCreateCompany(t, server, types.Company{
+		Name:    "First & Co",
+		Code:    "FIRST",
+		Country: "GB",
+		Website: "https://first.com/",
+		Phone:   "+111",
+	})
+
+	tests := []struct {
+		accept      string
+		contentType string
+		body        string
+	}{
+		{
+			"application/json",
+			"application/json",
+			`[{"Id":1,"Name":"First \u0026 Co","Code":"FIRST","Country":"GB","Website":"https://first.com/","Phone":"+111","Version":1}]`,
+		},
+		{
+			"application/x-ndjson",
+			"application/x-ndjson",
+			`{"Id":1,"Name":"First \u0026 Co","Code":"FIRST","Country":"GB","Website":"https://first.com/","Phone":"+111","Version":1}` + "\n",
+		},
+		{
+			"text/csv",
+			"text/csv; charset=utf-8",
+			"id,name,code,country,website,phone,version\n1,First & Co,FIRST,GB,https://first.com/,+111,1\n",
+		},
+		{
+			"application/xml",
+			"application/xml; charset=utf-8",
+			`<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+				`<companies><company><id>1</id><name>First &amp; Co</name><code>FIRST</code><country>GB</country>` +
+				`<website>https://first.com/</website><phone>+111</phone><version>1</version></company></companies>`,
+		},
+	}
+	tags := make(map[string]bool)
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			req := httptest.NewRequest("GET", baseURL, nil)
+			req.Header.Set("Accept", tt.accept)
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, req)
+			require.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.contentType, w.Result().Header.Get("Content-Type"))
+			assert.Equal(t, tt.body, w.Body.String())
+			tags[w.Result().Header.Get("ETag")] = true
+		})
+	}
+	assert.Len(t, tags, len(tests), "each format has its own entity tag")
+
+	t.Run("not acceptable", func(t *testing.T) {
+		req := httptest.NewRequest("GET", baseURL, nil)
+		req.Header.Set("Accept", "image/png")
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotAcceptable, w.Code)
+	})
+}
@@ -1,51 +1,113 @@
 package server
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/irmatov/companies/filter"
+	"github.com/irmatov/companies/problem"
+	"github.com/irmatov/companies/types"
 	"github.com/julienschmidt/httprouter"
 )
 
-// get will handle GET requests to /companies/
+// get will handle GET requests to /companies/. The response format is selected
+// by the format query parameter or the Accept header. The list may be sorted and
+// paged with the sort, limit and offset parameters. With stream=true the result
+// is written as it is read from the storage, which suits unbounded exports.
 func (s *server) getMany(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	w.Header().Add("Vary", "Accept")
+	format, ok := negotiateFormat(r)
+	if !ok {
+		writeProblem(w, r, http.StatusNotAcceptable, problem.CodeNotAcceptable, "")
+		return
+	}
 	var f filter.Filter
 	var err error
 	if expr := r.FormValue("filter"); expr != "" {
 		f, err = filter.Execute(knownFields, expr)
 		if err != nil {
-			writeJson(w, http.StatusBadRequest, fmt.Sprintf("invalid filter expression: %s", err))
+			writeProblem(w, r, http.StatusBadRequest, problem.CodeInvalidFilter, err.Error())
 			return
 		}
 	}
+	p, err := parsePage(r)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, err.Error())
+		return
+	}
+	if stream, _ := strconv.ParseBool(r.FormValue("stream")); stream {
+		if !p.empty() {
+			writeProblem(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "sort, limit and offset are not available with stream")
+			return
+		}
+		s.stream(w, r, format, f)
+		return
+	}
 	companies, err := s.svc.Get(r.Context(), f)
 	if err != nil {
-		writeJson(w, http.StatusInternalServerError, genericError{"internal server error"})
+		writeError(w, r, err)
+		return
+	}
+	companies = p.apply(companies)
+	// The newest update time of the companies misses the deleted ones, so the list has
+	// no Last-Modified and only its entity tag is compared.
+	if notModified(w, r, collectionETag(format.name, companies), time.Time{}) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	var buf bytes.Buffer
+	enc := format.newEncoder(&buf, s.wireCompany)
+	for _, c := range companies {
+		if err = enc.Encode(c); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = enc.Close()
+	}
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
-	writeJson(w, http.StatusOK, companies)
+	w.Header().Set("Content-Type", format.contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
 }
 
 func (s *server) getSingle(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	id, err := strconv.Atoi(ps.ByName("id"))
 	if err != nil {
-		writeJson(w, http.StatusBadRequest, genericError{err.Error()})
+		writeProblem(w, r, http.StatusBadRequest, problem.CodeInvalidId, "company id must be an integer")
+		return
+	}
+	c, err := s.getById(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
+	if notModified(w, r, etag(c.Version), c.UpdatedAt) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeJson(w, http.StatusOK, s.wireCompany(c))
+}
+
+// getById returns the company with the given id or types.ErrNotFound.
+func (s *server) getById(ctx context.Context, id int) (types.Company, error) {
 	f, err := filter.Execute(knownFields, fmt.Sprintf("id,%d,=", id))
 	if err != nil {
-		writeJson(w, http.StatusInternalServerError, genericError{"internal server error"})
+		return types.Company{}, err
 	}
-	result, err := s.svc.Get(r.Context(), f)
+	result, err := s.svc.Get(ctx, f)
 	if err != nil {
-		writeJson(w, http.StatusInternalServerError, genericError{"internal server error"})
-		return
+		return types.Company{}, err
 	}
 	if len(result) == 0 {
-		writeJson(w, http.StatusNotFound, genericError{"not found"})
-		return
+		return types.Company{}, types.ErrNotFound
 	}
-	writeJson(w, http.StatusOK, result[0])
+	return result[0], nil
 }
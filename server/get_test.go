@@ -6,7 +6,9 @@ import (
 	"net/http/httptest"
 	"strconv"
 	"testing"
+	"time"
 
+	"github.com/irmatov/companies/mockdb"
 	"github.com/irmatov/companies/types"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -18,11 +20,12 @@ func TestServerGet(t *testing.T) {
 	c1 := types.Company{
 		Name:    "First Company",
 		Code:    "FIRST",
-		Country: "UK",
+		Country: "GB",
 		Website: "https://first.com/",
 		Phone:   "+111",
 	}
 	c1.Id = testCreateCompany(t, server, c1)
+	c1.Version = 1
 
 	c2 := types.Company{
 		Name:    "Second Company",
@@ -32,6 +35,7 @@ func TestServerGet(t *testing.T) {
 		Phone:   "+222",
 	}
 	c2.Id = testCreateCompany(t, server, c2)
+	c2.Version = 1
 
 	c3 := types.Company{
 		Name:    "Third Company",
@@ -41,6 +45,7 @@ func TestServerGet(t *testing.T) {
 		Phone:   "+333",
 	}
 	c3.Id = testCreateCompany(t, server, c3)
+	c3.Version = 1
 
 	t.Run("get all companies", func(t *testing.T) {
 		req := httptest.NewRequest("GET", baseURL, nil)
@@ -79,6 +84,66 @@ func TestServerGet(t *testing.T) {
 		assert.Equal(t, []types.Company{c1, c3}, r)
 	})
 
+	t.Run("conditional get of a single company", func(t *testing.T) {
+		req := httptest.NewRequest("GET", baseURL+strconv.Itoa(c1.Id), nil)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		tag := w.Result().Header.Get("ETag")
+		assert.Equal(t, `"1"`, tag)
+		modified := w.Result().Header.Get("Last-Modified")
+		require.NotEmpty(t, modified)
+
+		req = httptest.NewRequest("GET", baseURL+strconv.Itoa(c1.Id), nil)
+		req.Header.Set("If-None-Match", tag)
+		w = httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotModified, w.Code)
+		assert.Empty(t, w.Body.Bytes())
+
+		req = httptest.NewRequest("GET", baseURL+strconv.Itoa(c1.Id), nil)
+		req.Header.Set("If-Modified-Since", modified)
+		w = httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotModified, w.Code)
+
+		req = httptest.NewRequest("GET", baseURL+strconv.Itoa(c1.Id), nil)
+		req.Header.Set("If-None-Match", `"2"`)
+		req.Header.Set("If-Modified-Since", modified)
+		w = httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("conditional get of all companies", func(t *testing.T) {
+		req := httptest.NewRequest("GET", baseURL, nil)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		tag := w.Result().Header.Get("ETag")
+		require.NotEmpty(t, tag)
+		assert.Empty(t, w.Result().Header.Get("Last-Modified"))
+
+		req = httptest.NewRequest("GET", baseURL, nil)
+		req.Header.Set("If-None-Match", tag)
+		w = httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotModified, w.Code)
+
+		// removing a company changes the collection tag
+		req = httptest.NewRequest("DELETE", baseURL+strconv.Itoa(c3.Id), nil)
+		w = httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		require.Equal(t, http.StatusNoContent, w.Code)
+
+		req = httptest.NewRequest("GET", baseURL, nil)
+		req.Header.Set("If-None-Match", tag)
+		w = httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NotEqual(t, tag, w.Result().Header.Get("ETag"))
+	})
+
 	t.Run("get non existing", func(t *testing.T) {
 		req := httptest.NewRequest("GET", baseURL+"999", nil)
 		w := httptest.NewRecorder()
@@ -86,3 +151,32 @@ func TestServerGet(t *testing.T) {
 		assert.Equal(t, http.StatusNotFound, w.Code)
 	})
 }
+
+func TestServerGetAfterDelete(t *testing.T) {
+	server := New(mockdb.New())
+	id := testCreateCompany(t, server, types.Company{Name: "Hydrogen", Code: "HYDRO", Country: "CY"})
+	testCreateCompany(t, server, types.Company{Name: "Helium", Code: "HE", Country: "FR"})
+
+	req := httptest.NewRequest("GET", baseURL, nil)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	tag := w.Result().Header.Get("ETag")
+
+	req = httptest.NewRequest("DELETE", baseURL+strconv.Itoa(id), nil)
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	require.Equal(t, http.StatusNoContent, w.Code)
+
+	// deleting a company does not change the update times of the remaining ones
+	since := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	req = httptest.NewRequest("GET", baseURL, nil)
+	req.Header.Set("If-Modified-Since", since)
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotEqual(t, tag, w.Result().Header.Get("ETag"))
+	var r []types.Company
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &r))
+	assert.Len(t, r, 1)
+}
@@ -32,6 +32,16 @@ func testCreateCompany(t *testing.T, h http.Handler, c types.Company) int {
 	return r.Id
 }
 
+func testGetCompanies(t *testing.T, h http.Handler) []types.Company {
+	req := httptest.NewRequest("GET", baseURL, nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var r []types.Company
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &r))
+	return r
+}
+
 func getTestDatabase(t *testing.T) types.Storage {
 	db, err := sql.Open("pgx", "user=postgres password=postgres dbname=postgres host=localhost sslmode=disable")
 	require.NoError(t, err)
@@ -48,7 +58,21 @@ func getTestDatabase(t *testing.T) types.Storage {
         code TEXT NOT NULL,
         country TEXT NOT NULL,
         website TEXT,
-        phone TEXT
+        phone TEXT,
+        version INTEGER NOT NULL DEFAULT 1,
+        updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+    )`)
+	require.NoError(t, err)
+	_, err = db.Exec("DROP TABLE IF EXISTS idempotency_keys")
+	require.NoError(t, err)
+	_, err = db.Exec(`
+    CREATE TABLE idempotency_keys (
+        key TEXT PRIMARY KEY,
+        fingerprint TEXT NOT NULL,
+        status INTEGER NOT NULL,
+        content_type TEXT NOT NULL,
+        body BYTEA NOT NULL DEFAULT '',
+        created_at TIMESTAMPTZ NOT NULL
     )`)
 	require.NoError(t, err)
 	return postgres.New(db)
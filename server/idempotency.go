@@ -0,0 +1,134 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/irmatov/companies/problem"
+	"github.com/irmatov/companies/types"
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	idempotencyKeyHeader    = "Idempotency-Key"
+	idempotencyTTL          = 24 * time.Hour
+	maxIdempotencyKeyLength = 255
+)
+
+// idempotent makes the handler honour the Idempotency-Key header. The first response
+// to a request with a key is stored and replayed for the retries, which must be the
+// same request. Server errors are not stored, so such requests can be retried; the
+// same is true if the response can not be stored.
+func (s *server) idempotent(h httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		if key == "" {
+			h(w, r, ps)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			writeProblem(w, r, http.StatusBadRequest, problem.CodeInvalidIdempotencyKey, "idempotency key is too long")
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeProblem(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "failed to read the request body")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		fingerprint := requestFingerprint(r, body)
+
+		stored, reserved, err := s.svc.ReserveKey(r.Context(), key, fingerprint, idempotencyTTL)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		if !reserved {
+			switch {
+			case stored.Fingerprint != fingerprint:
+				writeProblem(w, r, http.StatusUnprocessableEntity, problem.CodeIdempotencyKeyReused, "idempotency key has been used with a different request")
+			case stored.Status == 0:
+				writeProblem(w, r, http.StatusConflict, problem.CodeRequestInProgress, "request with the same idempotency key is in progress")
+			default:
+				replay(w, stored)
+			}
+			return
+		}
+
+		rec := &recordingWriter{ResponseWriter: w}
+		h(rec, r, ps)
+		// the request context may be canceled by now, the key must be saved regardless
+		ctx := context.Background()
+		if rec.status == 0 || rec.status >= http.StatusInternalServerError {
+			err = s.svc.ReleaseKey(ctx, key)
+		} else {
+			// the body must not be nil even if nothing has been written, e.g. for 204,
+			// as that would be stored as NULL
+			err = s.svc.SaveResponse(ctx, types.Response{
+				Key:         key,
+				Status:      rec.status,
+				ContentType: rec.Header().Get("Content-Type"),
+				Body:        append([]byte{}, rec.body.Bytes()...),
+			})
+			if err != nil {
+				log.Printf("failed to store response for idempotency key %q: %v", key, err)
+				// the retries would be reported as in progress until the key expires
+				err = s.svc.ReleaseKey(ctx, key)
+			}
+		}
+		if err != nil {
+			log.Printf("failed to release idempotency key %q: %v", key, err)
+		}
+	}
+}
+
+// requestFingerprint identifies the request a key is used with.
+func requestFingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	for _, s := range []string{r.Method, r.URL.Path, r.URL.RawQuery, r.Header.Get("Content-Type")} {
+		io.WriteString(h, s)
+		h.Write([]byte{0})
+	}
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// replay writes the stored response.
+func replay(w http.ResponseWriter, stored types.Response) {
+	if stored.ContentType != "" {
+		w.Header().Set("Content-Type", stored.ContentType)
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(stored.Status)
+	w.Write(stored.Body)
+}
+
+// recordingWriter passes the response through keeping a copy of it.
+type recordingWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *recordingWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if w.status != http.StatusNoContent {
+		w.body.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
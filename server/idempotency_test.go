@@ -0,0 +1,144 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/irmatov/companies/mockdb"
+	"github.com/irmatov/companies/problem"
+	"github.com/irmatov/companies/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerIdempotency(t *testing.T) {
+	testServerIdempotency(t, mockdb.New())
+}
+
+func TestServerIdempotencyPostgres(t *testing.T) {
+	testServerIdempotency(t, getTestDatabase(t))
+}
+
+func testServerIdempotency(t *testing.T, storage types.Storage) {
+	h := New(storage)
+	post := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v2/companies/", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", key)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+	problemCode := func(t *testing.T, w *httptest.ResponseRecorder) problem.Code {
+		var p problem.Problem
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+		return p.Code
+	}
+	const hydrogen = `{"name": "Hydrogen", "code": "HYDRO", "country": "CY"}`
+
+	w := post("first", hydrogen)
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, `{"id":1}`, w.Body.String())
+	assert.Empty(t, w.Result().Header.Get("Idempotent-Replayed"))
+
+	t.Run("retry", func(t *testing.T) {
+		w := post("first", hydrogen)
+		require.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, `{"id":1}`, w.Body.String())
+		assert.Equal(t, "application/json", w.Result().Header.Get("Content-Type"))
+		assert.Equal(t, "true", w.Result().Header.Get("Idempotent-Replayed"))
+	})
+
+	t.Run("errors are replayed", func(t *testing.T) {
+		conflict := `{"name": "Hydrogen", "code": "OTHER", "country": "CY"}`
+		w := post("conflict", conflict)
+		require.Equal(t, http.StatusConflict, w.Code)
+		w = post("conflict", conflict)
+		require.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, problem.CodeAlreadyExists, problemCode(t, w))
+		assert.Equal(t, "true", w.Result().Header.Get("Idempotent-Replayed"))
+	})
+
+	t.Run("key reused", func(t *testing.T) {
+		w := post("first", `{"name": "Helium", "code": "HE", "country": "FR"}`)
+		require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Equal(t, problem.CodeIdempotencyKeyReused, problemCode(t, w))
+	})
+
+	t.Run("in progress", func(t *testing.T) {
+		body := `{"name": "Helium", "code": "HE", "country": "FR"}`
+		req := httptest.NewRequest("POST", "/v2/companies/", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		_, reserved, err := h.(*server).svc.ReserveKey(context.Background(), "pending", requestFingerprint(req, []byte(body)), idempotencyTTL)
+		require.NoError(t, err)
+		require.True(t, reserved)
+		w := post("pending", body)
+		require.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, problem.CodeRequestInProgress, problemCode(t, w))
+	})
+
+	t.Run("invalid key", func(t *testing.T) {
+		w := post(strings.Repeat("k", maxIdempotencyKeyLength+1), hydrogen)
+		require.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, problem.CodeInvalidIdempotencyKey, problemCode(t, w))
+	})
+
+	t.Run("patch", func(t *testing.T) {
+		patch := func() *httptest.ResponseRecorder {
+			req := httptest.NewRequest("PATCH", "/v2/companies/1", strings.NewReader(`{"phone": "+35722123456"}`))
+			req.Header.Set("Content-Type", "application/merge-patch+json")
+			req.Header.Set("If-Match", `"1"`)
+			req.Header.Set("Idempotency-Key", "patch")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			return w
+		}
+		require.Equal(t, http.StatusNoContent, patch().Code)
+		// without the key the retry would fail as the version has changed
+		w := patch()
+		require.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, "true", w.Result().Header.Get("Idempotent-Replayed"))
+	})
+}
+
+// failingResponses is a storage which can not store responses to the requests.
+type failingResponses struct {
+	types.Storage
+}
+
+func (s failingResponses) Tx(ctx context.Context, action func(types.Tx) error) error {
+	return s.Storage.Tx(ctx, func(tx types.Tx) error {
+		return action(failingResponsesTx{tx})
+	})
+}
+
+type failingResponsesTx struct {
+	types.Tx
+}
+
+func (tx failingResponsesTx) UpdateResponse(r types.Response) error {
+	return errors.New("storage failure")
+}
+
+func TestServerIdempotencySaveFailure(t *testing.T) {
+	storage := mockdb.New()
+	h := New(failingResponses{storage})
+	req := httptest.NewRequest("POST", "/v2/companies/", strings.NewReader(`{"name": "Hydrogen", "code": "HYDRO", "country": "CY"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", "first")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	// the key is released, so it is not reported as in progress
+	err := storage.Tx(context.Background(), func(tx types.Tx) error {
+		_, err := tx.GetResponse("first")
+		return err
+	})
+	assert.Equal(t, types.ErrNotFound, err)
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/irmatov/companies/companycsv"
+	"github.com/irmatov/companies/problem"
+	"github.com/irmatov/companies/service"
+	"github.com/irmatov/companies/types"
+	"github.com/julienschmidt/httprouter"
+)
+
+// importCSV will handle POST requests to /companies/_import. The body is a CSV file
+// with a header row. dry_run=true query parameter reports the outcome without storing
+// anything, mode=upsert updates existing companies with the same name.
+func (s *server) importCSV(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	if mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mt != "text/csv" {
+		writeProblem(w, r, http.StatusBadRequest, problem.CodeInvalidContentType, "")
+		return
+	}
+	var opts service.ImportOptions
+	switch r.URL.Query().Get("mode") {
+	case "", "create":
+	case "upsert":
+		opts.Upsert = true
+	default:
+		writeProblem(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "invalid mode")
+		return
+	}
+	if v := r.URL.Query().Get("dry_run"); v != "" {
+		var err error
+		if opts.DryRun, err = strconv.ParseBool(v); err != nil {
+			writeProblem(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "invalid dry_run")
+			return
+		}
+	}
+	rows, err := companycsv.Read(r.Body)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, problem.CodeInvalidCsv, err.Error())
+		return
+	}
+
+	resp := importResponse{DryRun: opts.DryRun, Rows: make([]importRow, len(rows))}
+	companies := make([]types.Company, 0, len(rows))
+	index := make([]int, 0, len(rows)) // maps companies to rows
+	for i, row := range rows {
+		resp.Rows[i].Line = row.Line
+		if row.Err != nil {
+			resp.Rows[i].Action = service.ImportFailed
+			resp.Rows[i].Error = problem.New(http.StatusBadRequest, problem.CodeInvalidCsv, row.Err.Error())
+			continue
+		}
+		companies = append(companies, row.Company)
+		index = append(index, i)
+	}
+	results, err := s.svc.Import(r.Context(), companies, opts)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	for i, result := range results {
+		row := &resp.Rows[index[i]]
+		row.Id = result.Id
+		row.Action = result.Action
+		if result.Err != nil {
+			row.Error = serviceError(result.Err)
+		}
+	}
+	for _, row := range resp.Rows {
+		switch row.Action {
+		case service.ImportCreated:
+			resp.Created++
+		case service.ImportUpdated:
+			resp.Updated++
+		case service.ImportUnchanged:
+			resp.Unchanged++
+		case service.ImportFailed:
+			resp.Failed++
+		}
+	}
+	writeJson(w, http.StatusOK, s.wire(resp))
+}
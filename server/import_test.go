@@ -0,0 +1,71 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/irmatov/companies/mockdb"
+	"github.com/irmatov/companies/problem"
+	"github.com/irmatov/companies/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerImport(t *testing.T) {
+	server := New(mockdb.New())
+	const data = "name,code,country\nFirst Company,FIRST,GB\nSecond Company,SECOND,Atlantis\nThird Company\n"
+
+	t.Run("wrong content-type", func(t *testing.T) {
+		req := httptest.NewRequest("POST", baseURL+"_import", strings.NewReader(data))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("invalid header", func(t *testing.T) {
+		req := httptest.NewRequest("POST", baseURL+"_import", strings.NewReader("title\nFirst\n"))
+		req.Header.Set("Content-Type", "text/csv")
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	for _, dryRun := range []bool{true, false} {
+		name := "import"
+		query := ""
+		if dryRun {
+			name = "dry run"
+			query = "?dry_run=true"
+		}
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", baseURL+"_import"+query, strings.NewReader(data))
+			req.Header.Set("Content-Type", "text/csv; charset=utf-8")
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, req)
+			require.Equal(t, http.StatusOK, w.Code)
+			var r legacyImportResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &r))
+			assert.Equal(t, dryRun, r.DryRun)
+			assert.Equal(t, 1, r.Created)
+			assert.Equal(t, 2, r.Failed)
+			require.Len(t, r.Rows, 3)
+			assert.Equal(t, service.ImportCreated, r.Rows[0].Action)
+			assert.Equal(t, 3, r.Rows[1].Line)
+			require.NotNil(t, r.Rows[1].Error)
+			assert.Equal(t, problem.CodeValidationFailed, r.Rows[1].Error.Code)
+			require.NotNil(t, r.Rows[2].Error)
+			assert.Equal(t, problem.CodeInvalidCsv, r.Rows[2].Error.Code)
+			assert.Equal(t, 4, r.Rows[2].Line)
+			assert.Equal(t, service.ImportFailed, r.Rows[2].Action)
+			if dryRun {
+				assert.Empty(t, testGetCompanies(t, server))
+			} else {
+				assert.Len(t, testGetCompanies(t, server), 1)
+			}
+		})
+	}
+}
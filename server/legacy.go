@@ -0,0 +1,85 @@
+package server
+
+import (
+	"github.com/irmatov/companies/problem"
+	"github.com/irmatov/companies/service"
+	"github.com/irmatov/companies/types"
+)
+
+// The types below keep the capitalized field names API version 1 has been using
+// since types.Company was sent as is. Requests are decoded into the current
+// types, encoding/json matches field names case-insensitively.
+
+type legacyCompany struct {
+	Id      int    `json:"Id"`
+	Name    string `json:"Name"`
+	Code    string `json:"Code"`
+	Country string `json:"Country"`
+	Website string `json:"Website"`
+	Phone   string `json:"Phone"`
+	Version int    `json:"Version"`
+}
+
+type legacyCreated struct {
+	Id int `json:"Id"`
+}
+
+type legacyBulkResult struct {
+	Status int              `json:"Status"`
+	Id     int              `json:"Id,omitempty"`
+	Error  *problem.Problem `json:"Error,omitempty"`
+}
+
+type legacyImportResponse struct {
+	DryRun    bool              `json:"DryRun"`
+	Created   int               `json:"Created"`
+	Updated   int               `json:"Updated"`
+	Unchanged int               `json:"Unchanged"`
+	Failed    int               `json:"Failed"`
+	Rows      []legacyImportRow `json:"Rows"`
+}
+
+type legacyImportRow struct {
+	Line   int                  `json:"Line"`
+	Id     int                  `json:"Id,omitempty"`
+	Action service.ImportAction `json:"Action"`
+	Error  *problem.Problem     `json:"Error,omitempty"`
+}
+
+// wireCompany returns the representation of the company in the API version served by s.
+func (s *server) wireCompany(c types.Company) interface{} {
+	return s.wire(newCompany(c))
+}
+
+// wire returns the representation of a response in the API version served by s.
+func (s *server) wire(v interface{}) interface{} {
+	if !s.legacy {
+		return v
+	}
+	switch v := v.(type) {
+	case company:
+		return legacyCompany(v)
+	case created:
+		return legacyCreated(v)
+	case []bulkResult:
+		results := make([]legacyBulkResult, len(v))
+		for i, r := range v {
+			results[i] = legacyBulkResult(r)
+		}
+		return results
+	case importResponse:
+		resp := legacyImportResponse{
+			DryRun:    v.DryRun,
+			Created:   v.Created,
+			Updated:   v.Updated,
+			Unchanged: v.Unchanged,
+			Failed:    v.Failed,
+			Rows:      make([]legacyImportRow, len(v.Rows)),
+		}
+		for i, r := range v.Rows {
+			resp.Rows[i] = legacyImportRow(r)
+		}
+		return resp
+	}
+	return v
+}
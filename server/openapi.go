@@ -0,0 +1,29 @@
+package server
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const openapiPath = "/openapi.json"
+
+// openapiSpec and openapiSpecV2 are the OpenAPI 3 descriptions of the API versions,
+// openapi_test.go ensures they are in line with the routes and types.
+var (
+	//go:embed openapi.json
+	openapiSpec []byte
+	//go:embed openapi.v2.json
+	openapiSpecV2 []byte
+)
+
+func (s *server) openapi(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	spec := openapiSpecV2
+	if s.legacy {
+		spec = openapiSpec
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(spec)
+}
@@ -0,0 +1,169 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/irmatov/companies/mockdb"
+	"github.com/irmatov/companies/problem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type openapiDocument struct {
+	Paths      map[string]map[string]json.RawMessage
+	Components struct {
+		Schemas map[string]struct {
+			Properties map[string]json.RawMessage
+		}
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	h := New(mockdb.New())
+	for _, v := range []struct {
+		path string
+		// schemas maps the described schemas to the types they are encoded from
+		// or decoded into, the latter match field names case-insensitively.
+		schemas map[string]interface{}
+		decoded []string
+	}{
+		{"/v1/openapi.json", map[string]interface{}{
+			"Company":        legacyCompany{},
+			"Created":        legacyCreated{},
+			"BulkOperation":  bulkOperation{},
+			"BulkResult":     legacyBulkResult{},
+			"ImportResponse": legacyImportResponse{},
+			"ImportRow":      legacyImportRow{},
+			"Problem":        problem.Problem{},
+			"FieldError":     problem.FieldError{},
+		}, []string{"BulkOperation"}},
+		{"/v2/openapi.json", map[string]interface{}{
+			"Company":        company{},
+			"Created":        created{},
+			"BulkOperation":  bulkOperation{},
+			"BulkResult":     bulkResult{},
+			"ImportResponse": importResponse{},
+			"ImportRow":      importRow{},
+			"Problem":        problem.Problem{},
+			"FieldError":     problem.FieldError{},
+		}, nil},
+	} {
+		t.Run(v.path, func(t *testing.T) {
+			testOpenAPI(t, h, v.path, v.schemas, v.decoded)
+		})
+	}
+}
+
+func testOpenAPI(t *testing.T, h http.Handler, path string, schemas map[string]interface{}, decoded []string) {
+	req := httptest.NewRequest("GET", path, nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Result().Header.Get("Content-Type"))
+	var doc openapiDocument
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+
+	t.Run("routes", func(t *testing.T) {
+		// restricted routes must be described with 403 response
+		var routes, described []string
+		for _, r := range h.(*server).routes() {
+			path := regexp.MustCompile(`:(\w+)`).ReplaceAllString(r.path, "{$1}")
+			route := r.method + " " + path
+			if r.access == restricted {
+				route += " 403"
+			}
+			routes = append(routes, route)
+		}
+		for path, item := range doc.Paths {
+			for method, operation := range item {
+				if method == "parameters" {
+					continue
+				}
+				var op struct {
+					Responses map[string]json.RawMessage
+				}
+				require.NoError(t, json.Unmarshal(operation, &op))
+				route := strings.ToUpper(method) + " " + path
+				if _, ok := op.Responses["403"]; ok {
+					route += " 403"
+				}
+				described = append(described, route)
+			}
+		}
+		sort.Strings(routes)
+		sort.Strings(described)
+		assert.Equal(t, routes, described)
+	})
+
+	t.Run("schemas", func(t *testing.T) {
+		for name, v := range schemas {
+			schema, ok := doc.Components.Schemas[name]
+			if !assert.True(t, ok, name) {
+				continue
+			}
+			var properties []string
+			for p := range schema.Properties {
+				properties = append(properties, p)
+			}
+			sort.Strings(properties)
+			fields := jsonFieldNames(reflect.TypeOf(v))
+			for _, d := range decoded {
+				if d == name {
+					properties = lowercase(properties)
+					fields = lowercase(fields)
+				}
+			}
+			assert.Equal(t, fields, properties, name)
+		}
+	})
+
+	t.Run("references", func(t *testing.T) {
+		var generic map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &generic))
+		for _, ref := range regexp.MustCompile(`"\$ref":\s*"#/([^"]+)"`).FindAllStringSubmatch(w.Body.String(), -1) {
+			var node interface{} = generic
+			for _, part := range strings.Split(ref[1], "/") {
+				m, _ := node.(map[string]interface{})
+				node = m[part]
+			}
+			assert.NotNil(t, node, ref[1])
+		}
+	})
+}
+
+func lowercase(names []string) []string {
+	lower := make([]string, len(names))
+	for i, n := range names {
+		lower[i] = strings.ToLower(n)
+	}
+	sort.Strings(lower)
+	return lower
+}
+
+// jsonFieldNames returns sorted names of the fields encoding/json produces for the struct type.
+func jsonFieldNames(t reflect.Type) []string {
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		switch name {
+		case "-":
+			continue
+		case "":
+			name = f.Name
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/irmatov/companies/types"
+)
+
+// sortKey is a company field to order a list by.
+type sortKey struct {
+	field      string
+	descending bool
+}
+
+// page selects a part of the company list in the requested order.
+type page struct {
+	sort   []sortKey
+	limit  int // zero means no limit
+	offset int
+}
+
+// parsePage reads the sort, limit and offset query parameters. sort is a comma separated
+// list of fields, descending ones are prefixed with "-", e.g. country,-name.
+func parsePage(r *http.Request) (page, error) {
+	var p page
+	if v := r.FormValue("sort"); v != "" {
+		known := make(map[string]bool, len(knownFields))
+		for _, field := range knownFields {
+			known[field] = true
+		}
+		for _, field := range strings.Split(v, ",") {
+			key := sortKey{field: strings.TrimSpace(field)}
+			if strings.HasPrefix(key.field, "-") {
+				key.field, key.descending = key.field[1:], true
+			}
+			if !known[key.field] {
+				return page{}, fmt.Errorf("unknown sort field %q", key.field)
+			}
+			p.sort = append(p.sort, key)
+		}
+	}
+	if v := r.FormValue("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return page{}, fmt.Errorf("limit must be a positive integer")
+		}
+		p.limit = limit
+	}
+	if v := r.FormValue("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return page{}, fmt.Errorf("offset must be a non-negative integer")
+		}
+		p.offset = offset
+	}
+	return p, nil
+}
+
+// empty tells if the whole list is selected in the storage order.
+func (p page) empty() bool {
+	return len(p.sort) == 0 && p.limit == 0 && p.offset == 0
+}
+
+// apply sorts the companies and returns the selected part of them. The companies
+// equal by all the sort fields keep their storage order, i.e. by name.
+func (p page) apply(companies []types.Company) []types.Company {
+	if len(p.sort) > 0 {
+		sort.SliceStable(companies, func(i, j int) bool {
+			for _, key := range p.sort {
+				c := compareField(companies[i], companies[j], key.field)
+				if c == 0 {
+					continue
+				}
+				return c < 0 != key.descending
+			}
+			return false
+		})
+	}
+	if p.offset >= len(companies) {
+		return companies[:0]
+	}
+	companies = companies[p.offset:]
+	if p.limit > 0 && p.limit < len(companies) {
+		companies = companies[:p.limit]
+	}
+	return companies
+}
+
+// compareField compares a field of two companies, the result is negative, zero or
+// positive as a is less, equal or greater than b.
+func compareField(a, b types.Company, field string) int {
+	switch field {
+	case "id":
+		return a.Id - b.Id
+	case "name":
+		return strings.Compare(a.Name, b.Name)
+	case "code":
+		return strings.Compare(a.Code, b.Code)
+	case "country":
+		return strings.Compare(a.Country, b.Country)
+	case "website":
+		return strings.Compare(a.Website, b.Website)
+	case "phone":
+		return strings.Compare(a.Phone, b.Phone)
+	}
+	return 0
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/irmatov/companies/mockdb"
+	"github.com/irmatov/companies/problem"
+	"github.com/irmatov/companies/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerGetPage(t *testing.T) {
+	server := New(mockdb.New())
+	for _, c := range []types.Company{
+		{Name: "Hydrogen", Code: "HYDRO", Country: "CY"},
+		{Name: "Helium", Code: "HE", Country: "FR"},
+		{Name: "Lithium", Code: "LI", Country: "CY"},
+	} {
+		testCreateCompany(t, server, c)
+	}
+	names := func(query string) []string {
+		req := httptest.NewRequest("GET", baseURL+"?"+query, nil)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code, query)
+		var companies []types.Company
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &companies))
+		result := []string{}
+		for _, c := range companies {
+			result = append(result, c.Name)
+		}
+		return result
+	}
+
+	assert.Equal(t, []string{"Helium", "Hydrogen", "Lithium"}, names("sort=name"))
+	assert.Equal(t, []string{"Lithium", "Hydrogen", "Helium"}, names("sort=-name"))
+	assert.Equal(t, []string{"Hydrogen", "Lithium", "Helium"}, names("sort=country,id"))
+	assert.Equal(t, []string{"Helium", "Lithium", "Hydrogen"}, names("sort=-country,-id"))
+	assert.Equal(t, []string{"Helium", "Hydrogen"}, names("sort=name&limit=2"))
+	assert.Equal(t, []string{"Lithium"}, names("sort=name&limit=2&offset=2"))
+	assert.Equal(t, []string{}, names("offset=3"))
+	// the storage order is kept
+	assert.Equal(t, []string{"Hydrogen", "Helium", "Lithium"}, names(""))
+
+	for _, query := range []string{"sort=size", "sort=-", "limit=0", "limit=x", "offset=-1", "stream=true&limit=1"} {
+		req := httptest.NewRequest("GET", baseURL+"?"+query, nil)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		require.Equal(t, http.StatusBadRequest, w.Code, query)
+		var p problem.Problem
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+		assert.Equal(t, problem.CodeInvalidParameter, p.Code, query)
+	}
+}
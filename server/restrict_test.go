@@ -0,0 +1,55 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/irmatov/companies/mockdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerRestrict(t *testing.T) {
+	allowed := true
+	h := NewWithOptions(mockdb.New(), Options{Restrict: func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !allowed {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}})
+	do := func(method, path, body string) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code
+	}
+	const hydrogen = `{"name": "Hydrogen", "code": "HYDRO", "country": "CY"}`
+
+	require.Equal(t, http.StatusCreated, do("POST", "/v2/companies/", hydrogen))
+	require.Equal(t, http.StatusCreated, do("POST", "/v2/companies/", `{"name": "Helium", "code": "HE", "country": "CY"}`))
+
+	allowed = false
+	for _, prefix := range []string{"/v1", "/v2", ""} {
+		t.Run("denied "+prefix, func(t *testing.T) {
+			assert.Equal(t, http.StatusOK, do("GET", prefix+"/companies/", ""))
+			assert.Equal(t, http.StatusOK, do("GET", prefix+"/companies/1", ""))
+			assert.NotEqual(t, http.StatusForbidden, do("PUT", prefix+"/companies/1", hydrogen))
+			assert.Equal(t, http.StatusForbidden, do("POST", prefix+"/companies/", hydrogen))
+			assert.Equal(t, http.StatusForbidden, do("POST", prefix+"/companies/_bulk", "[]"))
+			assert.Equal(t, http.StatusForbidden, do("POST", prefix+"/companies/_import", ""))
+			assert.Equal(t, http.StatusForbidden, do("DELETE", prefix+"/companies/1", ""))
+		})
+	}
+
+	allowed = true
+	t.Run("route parameters are passed", func(t *testing.T) {
+		assert.Equal(t, http.StatusNoContent, do("DELETE", "/v2/companies/2", ""))
+		assert.Equal(t, http.StatusNotFound, do("GET", "/v2/companies/2", ""))
+	})
+}
@@ -1,11 +1,15 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"log"
 	"net/http"
 
+	"github.com/irmatov/companies/problem"
 	"github.com/irmatov/companies/service"
 	"github.com/irmatov/companies/types"
+	"github.com/irmatov/companies/validation"
 	"github.com/julienschmidt/httprouter"
 )
 
@@ -18,19 +22,89 @@ var knownFields = []string{"id", "name", "code", "country", "website", "phone"}
 type server struct {
 	svc service.Companies
 	mux http.Handler
+	// legacy is set for API version 1, see wire.
+	legacy bool
+}
+
+// route is an API endpoint. Every route must be described in openapi.json, the
+// restricted ones with 403 response.
+type route struct {
+	method string
+	path   string
+	handle httprouter.Handle
+	access access
+}
+
+// access tells who a route is served to.
+type access int
+
+const (
+	public access = iota
+	// restricted routes are served to the clients Options.Restrict lets through, per
+	// the requirements the ones creating or deleting companies.
+	restricted
+)
+
+// Options configure the server.
+type Options struct {
+	// Restrict wraps the handlers of the restricted routes, e.g. with the country
+	// check. All the routes are public if it is nil.
+	Restrict func(next http.Handler) http.Handler
 }
 
 func New(storage types.Storage) http.Handler {
+	return NewWithOptions(storage, Options{})
+}
+
+func NewWithOptions(storage types.Storage, opts Options) http.Handler {
 	router := httprouter.New()
-	s := &server{*service.New(storage), router}
-	router.GET(companiesPrefix, s.getMany)
-	router.GET(companiesPrefix+":id", s.getSingle)
-	router.POST(companiesPrefix, s.create)
-	router.DELETE(companiesPrefix+":id", s.delete)
-	router.PUT(companiesPrefix+":id", s.update)
+	// the Allow header is set by the router before calling MethodNotAllowed
+	router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeProblem(w, r, http.StatusNotFound, problem.CodeNotFound, "no such resource")
+	})
+	router.MethodNotAllowed = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeProblem(w, r, http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, "")
+	})
+	s := &server{svc: *service.New(storage), mux: router}
+	for _, v := range s.versions() {
+		for _, r := range v.routes {
+			handle := r.handle
+			if r.access == restricted && opts.Restrict != nil {
+				handle = restrict(opts.Restrict, handle)
+			}
+			router.Handle(r.method, v.prefix+r.path, v.deprecation.wrap(v.prefix, handle))
+		}
+	}
 	return s
 }
 
+// restrict turns the handle into http.Handler for the wrapper, the route parameters
+// are passed in the request context.
+func restrict(wrap func(http.Handler) http.Handler, h httprouter.Handle) httprouter.Handle {
+	next := wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h(w, r, httprouter.ParamsFromContext(r.Context()))
+	}))
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), httprouter.ParamsKey, ps)))
+	}
+}
+
+// routes returns the endpoints of the API relative to the version prefix.
+func (s *server) routes() []route {
+	return []route{
+		{http.MethodGet, companiesPrefix, s.getMany, public},
+		{http.MethodGet, companiesPrefix + ":id", s.getSingle, public},
+		{http.MethodPost, companiesPrefix, s.idempotent(s.create), restricted},
+		// bulk operations and imports may create or delete companies
+		{http.MethodPost, companiesPrefix + "_bulk", s.idempotent(s.bulk), restricted},
+		{http.MethodPost, companiesPrefix + "_import", s.idempotent(s.importCSV), restricted},
+		{http.MethodDelete, companiesPrefix + ":id", s.delete, restricted},
+		{http.MethodPut, companiesPrefix + ":id", s.update, public},
+		{http.MethodPatch, companiesPrefix + ":id", s.idempotent(s.patch), public},
+		{http.MethodGet, openapiPath, s.openapi, public},
+	}
+}
+
 func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	s.mux.ServeHTTP(w, r)
 }
@@ -45,3 +119,36 @@ func writeJson(w http.ResponseWriter, statusCode int, content interface{}) {
 	}
 	w.Write(b)
 }
+
+// serviceError maps an error returned by the companies service to a problem.
+func serviceError(err error) *problem.Problem {
+	switch err {
+	case types.ErrNotFound:
+		return problem.New(http.StatusNotFound, problem.CodeNotFound, "")
+	case types.ErrAlreadyExists:
+		return problem.New(http.StatusConflict, problem.CodeAlreadyExists, "company with the given name already exists")
+	case types.ErrVersionMismatch:
+		return problem.New(http.StatusPreconditionFailed, problem.CodePreconditionFailed, "company has been changed by someone else")
+	case types.ErrAborted:
+		return problem.New(http.StatusFailedDependency, problem.CodeAborted, "aborted due to another operation failure")
+	case types.ErrUnknownOperation:
+		return problem.New(http.StatusBadRequest, problem.CodeUnknownOperation, "")
+	}
+	if errs, ok := err.(validation.Errors); ok {
+		p := problem.New(http.StatusBadRequest, problem.CodeValidationFailed, "")
+		for _, fe := range errs {
+			p.WithErrors(problem.FieldError{Field: fe.Field, Code: problem.Code(fe.Code), Message: fe.Message})
+		}
+		return p
+	}
+	log.Printf("companies service error: %v", err)
+	return problem.New(http.StatusInternalServerError, problem.CodeInternal, "")
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	serviceError(err).Write(w, r)
+}
+
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, code problem.Code, detail string) {
+	problem.New(status, code, detail).Write(w, r)
+}
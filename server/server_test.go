@@ -0,0 +1,40 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/irmatov/companies/mockdb"
+	"github.com/irmatov/companies/problem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerFallbacks(t *testing.T) {
+	server := New(mockdb.New())
+	for _, tt := range []struct {
+		method, path string
+		status       int
+		code         problem.Code
+	}{
+		{"GET", "/v2/unknown", http.StatusNotFound, problem.CodeNotFound},
+		{"GET", "/v2/companies/1/unknown", http.StatusNotFound, problem.CodeNotFound},
+		{"DELETE", "/v2/companies/", http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed},
+	} {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		require.Equal(t, tt.status, w.Code, tt.path)
+		assert.Equal(t, problem.ContentType, w.Result().Header.Get("Content-Type"), tt.path)
+		var p problem.Problem
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+		assert.Equal(t, tt.code, p.Code, tt.path)
+		assert.Equal(t, tt.status, p.Status, tt.path)
+		assert.Equal(t, tt.path, p.Instance, tt.path)
+		if tt.status == http.StatusMethodNotAllowed {
+			assert.Contains(t, w.Result().Header.Get("Allow"), "GET")
+		}
+	}
+}
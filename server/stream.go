@@ -0,0 +1,76 @@
+package server
+
+import (
+	"bufio"
+	"log"
+	"net/http"
+
+	"github.com/irmatov/companies/filter"
+	"github.com/irmatov/companies/types"
+)
+
+const (
+	streamBufferSize = 32 * 1024
+	// streamFlushInterval is the number of companies after which the buffered output
+	// is sent to the client.
+	streamFlushInterval = 100
+)
+
+// headerWriter writes the response header right before the first byte of the body,
+// so the response status can still be changed until then.
+type headerWriter struct {
+	w           http.ResponseWriter
+	contentType string
+	started     bool
+}
+
+func (hw *headerWriter) Write(p []byte) (int, error) {
+	if !hw.started {
+		hw.started = true
+		hw.w.Header().Set("Content-Type", hw.contentType)
+		hw.w.WriteHeader(http.StatusOK)
+	}
+	return hw.w.Write(p)
+}
+
+// stream writes the companies that match the filter as they are read from the storage.
+// Entity tags are not available in this mode, as they depend on the whole list.
+func (s *server) stream(w http.ResponseWriter, r *http.Request, format format, f filter.Filter) {
+	hw := &headerWriter{w: w, contentType: format.contentType}
+	buf := bufio.NewWriterSize(hw, streamBufferSize)
+	enc := format.newEncoder(buf, s.wireCompany)
+	var count int
+	err := s.svc.Each(r.Context(), f, func(c types.Company) error {
+		if err := enc.Encode(c); err != nil {
+			return err
+		}
+		count++
+		if count%streamFlushInterval != 0 {
+			return nil
+		}
+		if err := buf.Flush(); err != nil {
+			return err
+		}
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = enc.Close()
+	}
+	if err == nil {
+		err = buf.Flush()
+	}
+	if err == nil {
+		return
+	}
+	if !hw.started {
+		writeError(w, r, err)
+		return
+	}
+	// the status has already been sent, the only way to tell the client
+	// the response is incomplete is to abort it
+	log.Printf("streaming companies: %v", err)
+	panic(http.ErrAbortHandler)
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/irmatov/companies/mockdb"
+	"github.com/irmatov/companies/problem"
+	"github.com/irmatov/companies/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerStream(t *testing.T) {
+	server := New(mockdb.New())
+	for i := 0; i < 2*streamFlushInterval+10; i++ {
+		testCreateCompany(t, server, types.Company{
+			Name:    fmt.Sprintf("Company %d", i),
+			Code:    fmt.Sprintf("C%d", i),
+			Country: "GB",
+		})
+	}
+
+	for _, f := range formats {
+		t.Run(f.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", baseURL+"?format="+f.name, nil)
+			buffered := httptest.NewRecorder()
+			server.ServeHTTP(buffered, req)
+			require.Equal(t, http.StatusOK, buffered.Code)
+
+			req = httptest.NewRequest("GET", baseURL+"?stream=true&format="+f.name, nil)
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, req)
+			require.Equal(t, http.StatusOK, w.Code)
+			assert.True(t, w.Flushed)
+			assert.Equal(t, f.contentType, w.Result().Header.Get("Content-Type"))
+			assert.Empty(t, w.Result().Header.Get("ETag"))
+			assert.Equal(t, buffered.Body.String(), w.Body.String())
+		})
+	}
+
+	t.Run("error before anything is sent", func(t *testing.T) {
+		// the mock storage does not support complex filters
+		req := httptest.NewRequest("GET", baseURL+`?stream=true&filter=name,"x",=,code,"y",=,or`, nil)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Equal(t, problem.ContentType, w.Result().Header.Get("Content-Type"))
+	})
+}
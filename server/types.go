@@ -1,5 +1,82 @@
 package server
 
-type genericError struct {
-	Error string
+import (
+	"github.com/irmatov/companies/problem"
+	"github.com/irmatov/companies/service"
+	"github.com/irmatov/companies/types"
+)
+
+// company is the API representation of types.Company. It is kept apart from the
+// domain type so the wire format does not change with the Go field names.
+type company struct {
+	Id      int    `json:"id"`
+	Name    string `json:"name"`
+	Code    string `json:"code"`
+	Country string `json:"country"`
+	Website string `json:"website,omitempty"`
+	Phone   string `json:"phone,omitempty"`
+	Version int    `json:"version"`
+}
+
+func newCompany(c types.Company) company {
+	return company{
+		Id:      c.Id,
+		Name:    c.Name,
+		Code:    c.Code,
+		Country: c.Country,
+		Website: c.Website,
+		Phone:   c.Phone,
+		Version: c.Version,
+	}
+}
+
+func (c company) domain() types.Company {
+	return types.Company{
+		Id:      c.Id,
+		Name:    c.Name,
+		Code:    c.Code,
+		Country: c.Country,
+		Website: c.Website,
+		Phone:   c.Phone,
+		Version: c.Version,
+	}
+}
+
+// created is the response to a successful create request.
+type created struct {
+	Id int `json:"id"`
+}
+
+// bulkOperation is a single element of a bulk request. Id and Version identify
+// the company for update and delete operations, Version works as If-Match does.
+type bulkOperation struct {
+	Op      string  `json:"op"`
+	Id      int     `json:"id,omitempty"`
+	Version int     `json:"version,omitempty"`
+	Company company `json:"company"`
+}
+
+// bulkResult is a single element of a bulk response.
+type bulkResult struct {
+	Status int              `json:"status"`
+	Id     int              `json:"id,omitempty"`
+	Error  *problem.Problem `json:"error,omitempty"`
+}
+
+// importResponse reports the outcome of a CSV import.
+type importResponse struct {
+	DryRun    bool        `json:"dry_run"`
+	Created   int         `json:"created"`
+	Updated   int         `json:"updated"`
+	Unchanged int         `json:"unchanged"`
+	Failed    int         `json:"failed"`
+	Rows      []importRow `json:"rows"`
+}
+
+// importRow is an outcome of importing a single CSV record.
+type importRow struct {
+	Line   int                  `json:"line"`
+	Id     int                  `json:"id,omitempty"`
+	Action service.ImportAction `json:"action"`
+	Error  *problem.Problem     `json:"error,omitempty"`
 }
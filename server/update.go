@@ -2,39 +2,90 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 
+	"github.com/irmatov/companies/problem"
 	"github.com/irmatov/companies/types"
 	"github.com/julienschmidt/httprouter"
 )
 
+var errIdMismatch = errors.New("id mismatch")
+
 func (s *server) update(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	id, err := strconv.Atoi(ps.ByName("id"))
 	if err != nil {
-		writeJson(w, http.StatusBadRequest, genericError{err.Error()})
+		writeProblem(w, r, http.StatusBadRequest, problem.CodeInvalidId, "company id must be an integer")
+		return
+	}
+	version, ok := ifMatchVersion(r)
+	if !ok {
+		writeProblem(w, r, http.StatusPreconditionFailed, problem.CodePreconditionFailed, "If-Match does not match any version")
 		return
 	}
 	if r.Header.Get("Content-Type") != "application/json" {
-		writeJson(w, http.StatusBadRequest, genericError{"invalid Content-Type"})
+		writeProblem(w, r, http.StatusBadRequest, problem.CodeInvalidContentType, "")
 		return
 	}
-	var c types.Company
+	var c company
 	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
-		writeJson(w, http.StatusBadRequest, genericError{"invalid JSON"})
+		writeProblem(w, r, http.StatusBadRequest, problem.CodeInvalidJson, "")
 		return
 	}
 	if c.Id != id {
-		writeJson(w, http.StatusBadRequest, genericError{"id mismatch"})
+		writeProblem(w, r, http.StatusBadRequest, problem.CodeIdMismatch, errIdMismatch.Error())
 		return
 	}
-	err = s.svc.Update(r.Context(), c)
+	if version != 0 {
+		c.Version = version
+	}
+	s.save(w, r, c.domain())
+}
+
+// patch will handle PATCH requests to /companies/:id. Fields present in the
+// request body replace the stored ones, all the others are left intact.
+func (s *server) patch(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id, err := strconv.Atoi(ps.ByName("id"))
 	if err != nil {
-		if err == types.ErrNotFound {
-			writeJson(w, http.StatusNotFound, genericError{err.Error()})
-			return
-		}
-		writeJson(w, http.StatusInternalServerError, genericError{"internal server error"})
+		writeProblem(w, r, http.StatusBadRequest, problem.CodeInvalidId, "company id must be an integer")
+		return
+	}
+	version, ok := ifMatchVersion(r)
+	if !ok {
+		writeProblem(w, r, http.StatusPreconditionFailed, problem.CodePreconditionFailed, "If-Match does not match any version")
+		return
+	}
+	if ct := r.Header.Get("Content-Type"); ct != "application/json" && ct != "application/merge-patch+json" {
+		writeProblem(w, r, http.StatusBadRequest, problem.CodeInvalidContentType, "")
+		return
+	}
+	existing, err := s.getById(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	c := newCompany(existing)
+	// the version we have just read is used as the expected one, so a concurrent
+	// modification between reading and writing is detected as well
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, problem.CodeInvalidJson, "")
+		return
+	}
+	if c.Id != id {
+		writeProblem(w, r, http.StatusBadRequest, problem.CodeIdMismatch, errIdMismatch.Error())
+		return
+	}
+	if version != 0 {
+		c.Version = version
+	}
+	s.save(w, r, c.domain())
+}
+
+// save stores the company and writes the response for update and patch requests.
+func (s *server) save(w http.ResponseWriter, r *http.Request, c types.Company) {
+	if err := s.svc.Update(r.Context(), c); err != nil {
+		writeError(w, r, err)
 		return
 	}
 	writeJson(w, http.StatusNoContent, nil)
@@ -19,11 +19,12 @@ func TestServerUpdate(t *testing.T) {
 	c1 := types.Company{
 		Name:    "First Company",
 		Code:    "FIRST",
-		Country: "UK",
+		Country: "GB",
 		Website: "https://first.com/",
 		Phone:   "+111",
 	}
 	c1.Id = testCreateCompany(t, server, c1)
+	c1.Version = 1
 
 	c2 := types.Company{
 		Name:    "Second Company",
@@ -33,6 +34,7 @@ func TestServerUpdate(t *testing.T) {
 		Phone:   "+222",
 	}
 	c2.Id = testCreateCompany(t, server, c2)
+	c2.Version = 1
 
 	t.Run("get all companies", func(t *testing.T) {
 		req := httptest.NewRequest("GET", baseURL, nil)
@@ -79,6 +81,7 @@ func TestServerUpdate(t *testing.T) {
 		w := httptest.NewRecorder()
 		server.ServeHTTP(w, req)
 		assert.Equal(t, http.StatusNoContent, w.Code)
+		c1.Version = 2
 	})
 
 	t.Run("changes are visible", func(t *testing.T) {
@@ -92,6 +95,42 @@ func TestServerUpdate(t *testing.T) {
 		assert.Equal(t, []types.Company{c1, c2}, r)
 	})
 
+	t.Run("update with stale If-Match", func(t *testing.T) {
+		stale := c1
+		stale.Phone = "+999"
+		b, err := json.Marshal(stale)
+		require.NoError(t, err)
+
+		req := httptest.NewRequest("PUT", baseURL+strconv.Itoa(c1.Id), bytes.NewBuffer(b))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", `"1"`)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	})
+
+	t.Run("patch with matching If-Match", func(t *testing.T) {
+		req := httptest.NewRequest("PATCH", baseURL+strconv.Itoa(c2.Id), bytes.NewBufferString(`{"Phone": "+2222"}`))
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+		req.Header.Set("If-Match", `"1"`)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		c2.Phone = "+2222"
+		c2.Version = 2
+	})
+
+	t.Run("patched company is visible", func(t *testing.T) {
+		req := httptest.NewRequest("GET", baseURL+strconv.Itoa(c2.Id), nil)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `"2"`, w.Result().Header.Get("ETag"))
+		var r types.Company
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &r))
+		assert.Equal(t, c2, r)
+	})
+
 	t.Run("update non-existing", func(t *testing.T) {
 		c1.Id = 999
 		b, err := json.Marshal(c1)
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// The unversioned paths predate API versioning and are kept as deprecated
+// aliases of version 1 until the sunset.
+var (
+	legacyDeprecated = time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+	legacySunset     = time.Date(2027, time.April, 19, 0, 0, 0, 0, time.UTC)
+)
+
+// apiVersion is a set of routes served under a common path prefix. Versions are
+// served side by side, so a breaking change goes to a new version while the old
+// one is kept, possibly deprecated, until its consumers migrate.
+type apiVersion struct {
+	prefix      string
+	routes      []route
+	deprecation *deprecation
+}
+
+// deprecation announces the removal of an API version with Deprecation
+// (RFC 9745), Sunset (RFC 8594) and successor-version Link headers.
+type deprecation struct {
+	since     time.Time
+	sunset    time.Time
+	successor string // prefix of the version to migrate to
+}
+
+func (s *server) versions() []apiVersion {
+	v1 := &server{svc: s.svc, legacy: true}
+	return []apiVersion{
+		{prefix: "/v1", routes: v1.routes()},
+		{prefix: "/v2", routes: s.routes()},
+		{prefix: "", routes: v1.routes(), deprecation: &deprecation{legacyDeprecated, legacySunset, "/v1"}},
+	}
+}
+
+// wrap returns the handler of a route served under prefix adding the deprecation
+// headers to its responses. A nil deprecation leaves the handler as is.
+func (d *deprecation) wrap(prefix string, h httprouter.Handle) httprouter.Handle {
+	if d == nil {
+		return h
+	}
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		header := w.Header()
+		header.Set("Deprecation", fmt.Sprintf("@%d", d.since.Unix()))
+		if !d.sunset.IsZero() {
+			header.Set("Sunset", d.sunset.Format(http.TimeFormat))
+		}
+		successor := d.successor + strings.TrimPrefix(r.URL.Path, prefix)
+		header.Add("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, successor))
+		h(w, r, ps)
+	}
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/irmatov/companies/mockdb"
+	"github.com/irmatov/companies/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerVersions(t *testing.T) {
+	server := New(mockdb.New())
+	id := strconv.Itoa(testCreateCompany(t, server, types.Company{Name: "Hydrogen", Code: "HYDRO", Country: "CY"}))
+
+	t.Run("v1", func(t *testing.T) {
+		for _, path := range []string{"/v1/companies/", "/v1/companies/" + id, "/v1/openapi.json"} {
+			req := httptest.NewRequest("GET", path, nil)
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, req)
+			require.Equal(t, http.StatusOK, w.Code, path)
+			assert.Empty(t, w.Result().Header.Get("Deprecation"), path)
+			assert.Empty(t, w.Result().Header.Get("Sunset"), path)
+		}
+	})
+
+	t.Run("unversioned", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/companies/"+id, nil)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		h := w.Result().Header
+		assert.Equal(t, "@1792368000", h.Get("Deprecation"))
+		assert.Equal(t, "Mon, 19 Apr 2027 00:00:00 GMT", h.Get("Sunset"))
+		assert.Equal(t, `</v1/companies/`+id+`>; rel="successor-version"`, h.Get("Link"))
+	})
+
+	t.Run("unversioned error", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/companies/0", nil)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		require.Equal(t, http.StatusNotFound, w.Code)
+		assert.NotEmpty(t, w.Result().Header.Get("Deprecation"))
+	})
+
+	t.Run("wire format", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/v2/companies/", strings.NewReader(`{"name": "Helium", "code": "HE", "country": "FR"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		require.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, `{"id":2}`, w.Body.String())
+
+		for path, expected := range map[string]string{
+			"/v1/companies/2": `{"Id":2,"Name":"Helium","Code":"HE","Country":"FR","Website":"","Phone":"","Version":1}`,
+			"/v2/companies/2": `{"id":2,"name":"Helium","code":"HE","country":"FR","version":1}`,
+			"/v2/companies/":  `[{"id":1,"name":"Hydrogen","code":"HYDRO","country":"CY","version":1},{"id":2,"name":"Helium","code":"HE","country":"FR","version":1}]`,
+		} {
+			req := httptest.NewRequest("GET", path, nil)
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, req)
+			require.Equal(t, http.StatusOK, w.Code, path)
+			assert.Equal(t, expected, w.Body.String(), path)
+		}
+	})
+
+	t.Run("unknown version", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/v3/companies/", nil)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
@@ -0,0 +1,26 @@
+package service
+
+import (
+	"context"
+	"log"
+
+	"github.com/irmatov/companies/types"
+)
+
+// AuditEntry records a change of a company and the client who requested it.
+type AuditEntry struct {
+	Operation OperationKind
+	CompanyId int
+	// Client is taken from the request context, see types.ClientFromContext.
+	Client types.Client
+}
+
+func logAudit(e AuditEntry) {
+	log.Printf("audit: %s company %d by %s", e.Operation, e.CompanyId, e.Client)
+}
+
+// record reports an applied change to the auditor.
+func (c *Companies) record(ctx context.Context, op OperationKind, id int) {
+	client, _ := types.ClientFromContext(ctx)
+	c.audit(AuditEntry{Operation: op, CompanyId: id, Client: client})
+}
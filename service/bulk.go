@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+
+	"github.com/irmatov/companies/types"
+	"github.com/irmatov/companies/validation"
+)
+
+// OperationKind identifies the kind of a bulk operation.
+type OperationKind string
+
+const (
+	OpCreate OperationKind = "create"
+	OpUpdate OperationKind = "update"
+	OpDelete OperationKind = "delete"
+)
+
+// Operation is a single change executed as a part of a bulk request. Only Id and
+// Version of the Company are used by delete operations.
+type Operation struct {
+	Kind    OperationKind
+	Company types.Company
+}
+
+// Result is an outcome of a single bulk operation. Id is set for successful creates.
+type Result struct {
+	Id  int
+	Err error
+}
+
+// Bulk executes the given operations in order. In atomic mode all the operations are
+// executed within a single transaction and either all of them succeed or none is
+// applied: the failed operation reports its error, all the others report
+// types.ErrAborted. Companies are validated before anything is executed, so all
+// the invalid ones are reported. Otherwise each operation is executed in its own transaction.
+// The returned error is only set if the outcome of the operations is unknown.
+func (c *Companies) Bulk(ctx context.Context, ops []Operation, atomic bool) ([]Result, error) {
+	results := make([]Result, len(ops))
+	if !atomic {
+		for i, op := range ops {
+			var written bool
+			results[i].Err = c.storage.Tx(ctx, func(tx types.Tx) error {
+				var err error
+				results[i].Id, written, err = execute(tx, op)
+				return err
+			})
+			if results[i].Err == nil && written {
+				c.recordOperation(ctx, op, results[i])
+			}
+		}
+		return results, nil
+	}
+
+	// report all invalid operations at once instead of stopping at the first one
+	var invalid bool
+	for i, op := range ops {
+		switch op.Kind {
+		case OpCreate, OpUpdate:
+			results[i].Err = validation.Company(Normalize(op.Company))
+		case OpDelete:
+		default:
+			results[i].Err = types.ErrUnknownOperation
+		}
+		invalid = invalid || results[i].Err != nil
+	}
+	if invalid {
+		for i := range results {
+			if results[i].Err == nil {
+				results[i].Err = types.ErrAborted
+			}
+		}
+		return results, nil
+	}
+
+	failed := -1
+	written := make([]bool, len(ops))
+	err := c.storage.Tx(ctx, func(tx types.Tx) error {
+		for i, op := range ops {
+			var err error
+			results[i].Id, written[i], err = execute(tx, op)
+			if err != nil {
+				failed = i
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		for i, op := range ops {
+			if written[i] {
+				c.recordOperation(ctx, op, results[i])
+			}
+		}
+		return results, nil
+	}
+	if failed == -1 {
+		return nil, err
+	}
+	for i := range results {
+		results[i] = Result{Err: types.ErrAborted}
+	}
+	results[failed].Err = err
+	return results, nil
+}
+
+// recordOperation reports an applied bulk operation to the auditor.
+func (c *Companies) recordOperation(ctx context.Context, op Operation, result Result) {
+	id := op.Company.Id
+	if op.Kind == OpCreate {
+		id = result.Id
+	}
+	c.record(ctx, op.Kind, id)
+}
+
+// execute applies the operation, written tells if anything has been stored: creating
+// a company identical to an existing one or updating it without changes does nothing.
+func execute(tx types.Tx, op Operation) (id int, written bool, err error) {
+	switch op.Kind {
+	case OpCreate:
+		return create(tx, op.Company)
+	case OpUpdate:
+		written, err = update(tx, op.Company)
+		return 0, written, err
+	case OpDelete:
+		err = remove(tx, op.Company.Id, op.Company.Version)
+		return 0, err == nil, err
+	default:
+		return 0, false, types.ErrUnknownOperation
+	}
+}
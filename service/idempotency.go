@@ -0,0 +1,50 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/irmatov/companies/types"
+)
+
+// ReserveKey claims the idempotency key for the request with the given fingerprint.
+// If the key has been used during the last ttl, the response stored for it is returned
+// and reserved is false, the response status is zero while the request which has
+// claimed the key is in progress. Expired keys are deleted on the way.
+func (c *Companies) ReserveKey(ctx context.Context, key, fingerprint string, ttl time.Duration) (stored types.Response, reserved bool, err error) {
+	now := time.Now().UTC()
+	err = c.storage.Tx(ctx, func(tx types.Tx) error {
+		if err := tx.ExpireResponses(now.Add(-ttl)); err != nil {
+			return err
+		}
+		// the body is not nil, as that would be stored as NULL
+		err := tx.CreateResponse(types.Response{Key: key, Fingerprint: fingerprint, Body: []byte{}, CreatedAt: now})
+		switch err {
+		case nil:
+			reserved = true
+			return nil
+		case types.ErrAlreadyExists:
+			stored, err = tx.GetResponse(key)
+			if err == types.ErrNotFound {
+				// released in the meantime, report it as in progress so the client retries
+				stored, err = types.Response{Key: key, Fingerprint: fingerprint}, nil
+			}
+		}
+		return err
+	})
+	return stored, reserved, err
+}
+
+// SaveResponse stores the response to the request which has reserved the key.
+func (c *Companies) SaveResponse(ctx context.Context, r types.Response) error {
+	return c.storage.Tx(ctx, func(tx types.Tx) error {
+		return tx.UpdateResponse(r)
+	})
+}
+
+// ReleaseKey forgets the reserved key, so the request can be retried with it.
+func (c *Companies) ReleaseKey(ctx context.Context, key string) error {
+	return c.storage.Tx(ctx, func(tx types.Tx) error {
+		return tx.DeleteResponse(key)
+	})
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+
+	"github.com/irmatov/companies/filter"
+	"github.com/irmatov/companies/types"
+	"github.com/irmatov/companies/validation"
+)
+
+// ImportOptions control the behaviour of Import.
+type ImportOptions struct {
+	// DryRun makes Import to report the outcome without storing anything.
+	DryRun bool
+	// Upsert makes Import to update existing companies with the same name
+	// instead of reporting types.ErrAlreadyExists for them.
+	Upsert bool
+}
+
+// ImportAction describes what has been done to an imported company.
+type ImportAction string
+
+const (
+	ImportCreated   ImportAction = "created"
+	ImportUpdated   ImportAction = "updated"
+	ImportUnchanged ImportAction = "unchanged"
+	ImportFailed    ImportAction = "failed"
+)
+
+// ImportResult is an outcome of importing a single company.
+type ImportResult struct {
+	Id     int
+	Action ImportAction
+	Err    error
+}
+
+const errDryRun = types.Error("dry run")
+
+// Import validates and stores the given companies within a single transaction.
+// Companies that fail are reported in their results and do not prevent the
+// others from being stored. The returned error is only set if nothing has been stored.
+func (c *Companies) Import(ctx context.Context, companies []types.Company, opts ImportOptions) ([]ImportResult, error) {
+	results := make([]ImportResult, len(companies))
+	err := c.storage.Tx(ctx, func(tx types.Tx) error {
+		for i, company := range companies {
+			r := &results[i]
+			r.Id, r.Action, r.Err = importOne(tx, company, opts.Upsert)
+			if r.Err != nil {
+				r.Action = ImportFailed
+			}
+		}
+		if opts.DryRun {
+			for i := range results {
+				if results[i].Action == ImportCreated {
+					// the identifiers are not going to exist after the rollback
+					results[i].Id = 0
+				}
+			}
+			return errDryRun
+		}
+		return nil
+	})
+	if err != nil && err != errDryRun {
+		return nil, err
+	}
+	if !opts.DryRun {
+		for _, r := range results {
+			switch r.Action {
+			case ImportCreated:
+				c.record(ctx, OpCreate, r.Id)
+			case ImportUpdated:
+				c.record(ctx, OpUpdate, r.Id)
+			}
+		}
+	}
+	return results, nil
+}
+
+func importOne(tx types.Tx, company types.Company, upsert bool) (int, ImportAction, error) {
+	company = Normalize(company)
+	if err := validation.Company(company); err != nil {
+		return 0, ImportFailed, err
+	}
+	existing, err := tx.Get(filter.Filter{Expr: "name = $1", Arguments: []interface{}{company.Name}})
+	if err != nil {
+		return 0, ImportFailed, err
+	}
+	if len(existing) == 0 {
+		id, err := tx.Create(company)
+		return id, ImportCreated, err
+	}
+	company.Id = existing[0].Id
+	company.Version = existing[0].Version
+	company.UpdatedAt = existing[0].UpdatedAt
+	if company == existing[0] {
+		return company.Id, ImportUnchanged, nil
+	}
+	if !upsert {
+		return 0, ImportFailed, types.ErrAlreadyExists
+	}
+	return company.Id, ImportUpdated, tx.Update(company)
+}
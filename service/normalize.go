@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	"github.com/irmatov/companies/filter"
+	"github.com/irmatov/companies/types"
+	"github.com/irmatov/companies/validation"
+)
+
+// phoneSeparators are the characters commonly used to group phone number digits.
+var phoneSeparators = strings.NewReplacer(" ", "", "\u00a0", "", "-", "", ".", "", "(", "", ")", "")
+
+// Normalize brings company attributes to their canonical form: surrounding spaces
+// are removed, country names and lower case codes are turned into ISO 3166-1 alpha-2
+// codes, phones with international prefix into E.164 and website scheme and host
+// are lower cased. Values that can not be normalized are left for validation to reject.
+func Normalize(c types.Company) types.Company {
+	c.Name = strings.TrimSpace(c.Name)
+	c.Code = strings.TrimSpace(c.Code)
+	c.Country = strings.TrimSpace(c.Country)
+	if code, ok := validation.LookupCountry(c.Country); ok {
+		c.Country = code
+	}
+	c.Website = normalizeWebsite(strings.TrimSpace(c.Website))
+	c.Phone = normalizePhone(strings.TrimSpace(c.Phone))
+	return c
+}
+
+func normalizeWebsite(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return s
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	return u.String()
+}
+
+func normalizePhone(s string) string {
+	phone := phoneSeparators.Replace(s)
+	if strings.HasPrefix(phone, "00") {
+		phone = "+" + phone[2:]
+	}
+	if !validation.IsPhone(phone) {
+		return s
+	}
+	return phone
+}
+
+// NormalizeResult describes a stored company that is not in its canonical form.
+type NormalizeResult struct {
+	Before types.Company
+	After  types.Company
+	// Err is set if the company could not be normalized, e.g. it is still invalid.
+	Err error
+}
+
+// NormalizeAll normalizes all stored companies within a single transaction and reports
+// the ones that have been changed or could not be changed. With dryRun nothing is stored.
+func (c *Companies) NormalizeAll(ctx context.Context, dryRun bool) ([]NormalizeResult, error) {
+	var results []NormalizeResult
+	err := c.storage.Tx(ctx, func(tx types.Tx) error {
+		companies, err := tx.Get(filter.Filter{})
+		if err != nil {
+			return err
+		}
+		for _, company := range companies {
+			normalized := Normalize(company)
+			if normalized == company {
+				continue
+			}
+			result := NormalizeResult{Before: company, After: normalized}
+			result.Err = validation.Company(normalized)
+			if result.Err == nil && !dryRun {
+				if err := tx.Update(normalized); err != nil {
+					return err
+				}
+				result.After.Version++
+			}
+			results = append(results, result)
+		}
+		return nil
+	})
+	return results, err
+}
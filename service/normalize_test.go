@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/irmatov/companies/filter"
+	"github.com/irmatov/companies/mockdb"
+	"github.com/irmatov/companies/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name string
+		in   types.Company
+		want types.Company
+	}{
+		{
+			"already normalized",
+			types.Company{Name: "Hydrogen", Code: "HYDRO", Country: "CY", Website: "https://hydrogen.io/", Phone: "+35722123456"},
+			types.Company{Name: "Hydrogen", Code: "HYDRO", Country: "CY", Website: "https://hydrogen.io/", Phone: "+35722123456"},
+		},
+		{
+			"surrounding spaces",
+			types.Company{Name: " Hydrogen ", Code: "HYDRO\t", Country: " CY", Website: " https://hydrogen.io/ ", Phone: " +35722123456"},
+			types.Company{Name: "Hydrogen", Code: "HYDRO", Country: "CY", Website: "https://hydrogen.io/", Phone: "+35722123456"},
+		},
+		{
+			"lower case country code",
+			types.Company{Country: "cy"},
+			types.Company{Country: "CY"},
+		},
+		{
+			"country name",
+			types.Company{Country: "cyprus"},
+			types.Company{Country: "CY"},
+		},
+		{
+			"unknown country",
+			types.Company{Country: "Atlantis"},
+			types.Company{Country: "Atlantis"},
+		},
+		{
+			"grouped phone",
+			types.Company{Phone: "+357 22-123.456"},
+			types.Company{Phone: "+35722123456"},
+		},
+		{
+			"international prefix",
+			types.Company{Phone: "00 357 (22) 123456"},
+			types.Company{Phone: "+35722123456"},
+		},
+		{
+			"national phone is left as is",
+			types.Company{Phone: "22 123456"},
+			types.Company{Phone: "22 123456"},
+		},
+		{
+			"website host",
+			types.Company{Website: "HTTPS://Hydrogen.IO/About"},
+			types.Company{Website: "https://hydrogen.io/About"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Normalize(tt.in))
+		})
+	}
+}
+
+func TestNormalizeAll(t *testing.T) {
+	storage := mockdb.New()
+	ctx := context.Background()
+	// store companies as they used to be stored before normalization
+	require.NoError(t, storage.Tx(ctx, func(tx types.Tx) error {
+		for _, c := range []types.Company{
+			{Name: "Hydrogen", Code: "HYDRO", Country: "CY", Phone: "+35722123456"},
+			{Name: "Helium", Code: "HE", Country: "Cyprus", Phone: "0035722123456"},
+			{Name: "Lithium", Code: "LI", Country: "Atlantis"},
+		} {
+			if _, err := tx.Create(c); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	svc := New(storage)
+
+	results, err := svc.NormalizeAll(ctx, true)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "Helium", results[0].Before.Name)
+	assert.NoError(t, results[0].Err)
+	assert.Equal(t, "CY", results[0].After.Country)
+
+	got, err := svc.Get(ctx, filter.Filter{Expr: "name = $1", Arguments: []interface{}{"Helium"}})
+	require.NoError(t, err)
+	assert.Equal(t, "Cyprus", got[0].Country, "dry run must not store anything")
+
+	results, err = svc.NormalizeAll(ctx, false)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	got, err = svc.Get(ctx, filter.Filter{Expr: "name = $1", Arguments: []interface{}{"Helium"}})
+	require.NoError(t, err)
+	assert.Equal(t, "CY", got[0].Country)
+	assert.Equal(t, "+35722123456", got[0].Phone)
+	assert.Equal(t, 2, got[0].Version)
+}
@@ -6,16 +6,19 @@ import (
 
 	"github.com/irmatov/companies/filter"
 	"github.com/irmatov/companies/types"
+	"github.com/irmatov/companies/validation"
 )
 
 // Companies provides an interface to perform various operations on companies.
 type Companies struct {
 	storage types.Storage
+	// audit receives the applied changes, they are logged.
+	audit func(AuditEntry)
 }
 
 // New creates a new instance of Companies service using a provided storage implementation.
 func New(storage types.Storage) *Companies {
-	return &Companies{storage}
+	return &Companies{storage: storage, audit: logAudit}
 }
 
 // Get returns a list of companies that match the provided filter.
@@ -29,57 +32,124 @@ func (c *Companies) Get(ctx context.Context, f filter.Filter) ([]types.Company,
 	return companies, err
 }
 
-// Create creates a new company and returns its ID.
+// Each calls fn for each company that matches the provided filter, without collecting
+// them in memory. The storage transaction is kept open until the iteration is over.
+func (c *Companies) Each(ctx context.Context, f filter.Filter, fn func(types.Company) error) error {
+	return c.storage.Tx(ctx, func(tx types.Tx) error {
+		return tx.Iterate(f, fn)
+	})
+}
+
+// Create creates a new company and returns its ID. The company is normalized first,
+// if its attributes are still not valid, validation.Errors is returned.
 func (c *Companies) Create(ctx context.Context, company types.Company) (int, error) {
 	var id int
+	var created bool
 	err := c.storage.Tx(ctx, func(tx types.Tx) error {
-		existing, err := tx.Get(filter.Filter{Expr: "name = $1", Arguments: []interface{}{company.Name}})
-		if err != nil {
-			return err
-		}
-		if len(existing) > 0 {
-			company.Id = existing[0].Id
-			if company == existing[0] {
-				id = company.Id
-				return nil
-			}
-			return types.ErrAlreadyExists
-		}
-		id, err = tx.Create(company)
+		var err error
+		id, created, err = create(tx, company)
 		return err
 	})
+	if err == nil && created {
+		c.record(ctx, OpCreate, id)
+	}
 	return id, err
 }
 
-// Update updates an existing company.
+// Update updates an existing company. If company.Version is not zero, it must match
+// the stored version, otherwise types.ErrVersionMismatch is returned. If the company
+// attributes are not valid, validation.Errors is returned.
 func (c *Companies) Update(ctx context.Context, company types.Company) error {
+	var changed bool
 	err := c.storage.Tx(ctx, func(tx types.Tx) error {
-		existing, err := tx.Get(filter.Filter{Expr: "id = $1", Arguments: []interface{}{company.Id}})
-		if err != nil {
-			return err
-		}
-		if len(existing) == 0 {
-			return types.ErrNotFound
-		}
-		if company == existing[0] {
-			return nil
-		}
-		return tx.Update(company)
+		var err error
+		changed, err = update(tx, company)
+		return err
 	})
+	if err == nil && changed {
+		c.record(ctx, OpUpdate, company.Id)
+	}
 	return err
 }
 
-// Delete deletes an existing company.
-func (c *Companies) Delete(ctx context.Context, id int) error {
+// Delete deletes an existing company. If version is not zero, it must match the stored
+// version, otherwise types.ErrVersionMismatch is returned.
+func (c *Companies) Delete(ctx context.Context, id int, version int) error {
 	err := c.storage.Tx(ctx, func(tx types.Tx) error {
-		existing, err := tx.Get(filter.Filter{Expr: "id = $1", Arguments: []interface{}{id}})
-		if err != nil {
-			return err
-		}
-		if len(existing) == 0 {
-			return types.ErrNotFound
-		}
-		return tx.Delete(id)
+		return remove(tx, id, version)
 	})
+	if err == nil {
+		c.record(ctx, OpDelete, id)
+	}
 	return err
 }
+
+// create stores the company unless an identical one exists, created tells which
+// one has happened.
+func create(tx types.Tx, company types.Company) (id int, created bool, err error) {
+	company = Normalize(company)
+	if err := validation.Company(company); err != nil {
+		return 0, false, err
+	}
+	existing, err := tx.Get(filter.Filter{Expr: "name = $1", Arguments: []interface{}{company.Name}})
+	if err != nil {
+		return 0, false, err
+	}
+	if len(existing) > 0 {
+		company.Id = existing[0].Id
+		company.Version = existing[0].Version
+		company.UpdatedAt = existing[0].UpdatedAt
+		if company == existing[0] {
+			return company.Id, false, nil
+		}
+		return 0, false, types.ErrAlreadyExists
+	}
+	id, err = tx.Create(company)
+	return id, err == nil, err
+}
+
+// update stores the company if it differs from the stored one, changed tells if it
+// has been stored.
+func update(tx types.Tx, company types.Company) (changed bool, err error) {
+	company = Normalize(company)
+	if err := validation.Company(company); err != nil {
+		return false, err
+	}
+	existing, err := tx.Get(filter.Filter{Expr: "id = $1", Arguments: []interface{}{company.Id}})
+	if err != nil {
+		return false, err
+	}
+	if len(existing) == 0 {
+		return false, types.ErrNotFound
+	}
+	if company.Version == 0 {
+		company.Version = existing[0].Version
+	}
+	if company.Version != existing[0].Version {
+		return false, types.ErrVersionMismatch
+	}
+	company.UpdatedAt = existing[0].UpdatedAt
+	if company == existing[0] {
+		return false, nil
+	}
+	if err := tx.Update(company); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func remove(tx types.Tx, id int, version int) error {
+	existing, err := tx.Get(filter.Filter{Expr: "id = $1", Arguments: []interface{}{id}})
+	if err != nil {
+		return err
+	}
+	if len(existing) == 0 {
+		return types.ErrNotFound
+	}
+	if version != 0 && version != existing[0].Version {
+		return types.ErrVersionMismatch
+	}
+	// the version is checked by the storage as well, as the company may be changed
+	// by a concurrent transaction in the meantime
+	return tx.Delete(id, version)
+}
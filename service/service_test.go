@@ -2,11 +2,14 @@ package service
 
 import (
 	"context"
+	"net/netip"
 	"testing"
+	"time"
 
 	"github.com/irmatov/companies/filter"
 	"github.com/irmatov/companies/mockdb"
 	"github.com/irmatov/companies/types"
+	"github.com/irmatov/companies/validation"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -30,11 +33,12 @@ func TestCompanies(t *testing.T) {
 	}
 	c1.Id, err = svc.Create(ctx, c1)
 	require.NoError(t, err)
+	c1.Version = 1
 
 	// ensure it is there
 	got, err := svc.Get(ctx, filter.Filter{Expr: "id = $1", Arguments: []interface{}{c1.Id}})
 	require.NoError(t, err)
-	require.Equal(t, []types.Company{c1}, got)
+	require.Equal(t, []types.Company{c1}, withoutTimestamps(t, got))
 
 	// adding the same company twice gives no error
 	c1.Id, err = svc.Create(ctx, c1)
@@ -50,39 +54,237 @@ func TestCompanies(t *testing.T) {
 	}
 	c2.Id, err = svc.Create(ctx, c2)
 	require.NoError(t, err)
+	c2.Version = 1
 
 	// ensure it is there
 	got, err = svc.Get(ctx, filter.Filter{Expr: "id = $1", Arguments: []interface{}{c2.Id}})
 	require.NoError(t, err)
-	require.Equal(t, []types.Company{c2}, got)
+	require.Equal(t, []types.Company{c2}, withoutTimestamps(t, got))
 
 	// list all companies
 	got, err = svc.Get(ctx, filter.Filter{})
 	require.NoError(t, err)
-	require.Equal(t, []types.Company{c1, c2}, got)
+	require.Equal(t, []types.Company{c1, c2}, withoutTimestamps(t, got))
 
 	// update the first company
 	c1.Website = "http://example.com/"
 	require.NoError(t, svc.Update(ctx, c1))
+	c1.Version = 2
+
+	// update with a stale version is rejected
+	stale := c1
+	stale.Version = 1
+	stale.Phone = "+1111111111"
+	require.Equal(t, types.ErrVersionMismatch, svc.Update(ctx, stale))
 
 	// list all companies, ensure the first one is updated
 	got, err = svc.Get(ctx, filter.Filter{})
 	require.NoError(t, err)
-	require.Equal(t, []types.Company{c1, c2}, got)
+	require.Equal(t, []types.Company{c1, c2}, withoutTimestamps(t, got))
+
+	// delete with a stale version is rejected
+	require.Equal(t, types.ErrVersionMismatch, svc.Delete(ctx, c2.Id, 2))
 
 	// drop the second company
-	require.NoError(t, svc.Delete(ctx, c2.Id))
+	require.NoError(t, svc.Delete(ctx, c2.Id, c2.Version))
 
 	// list all companies, ensure the second is missing
 	got, err = svc.Get(ctx, filter.Filter{})
 	require.NoError(t, err)
-	require.Equal(t, []types.Company{c1}, got)
+	require.Equal(t, []types.Company{c1}, withoutTimestamps(t, got))
 
 	// attempt to delete the same company again results in an error
-	require.Equal(t, types.ErrNotFound, svc.Delete(ctx, c2.Id))
+	require.Equal(t, types.ErrNotFound, svc.Delete(ctx, c2.Id, 0))
 
 	// list all companies
 	got, err = svc.Get(ctx, filter.Filter{})
 	require.NoError(t, err)
-	require.Equal(t, []types.Company{c1}, got)
+	require.Equal(t, []types.Company{c1}, withoutTimestamps(t, got))
+}
+
+// withoutTimestamps returns a copy of companies with modification times, which are
+// maintained by the storage, cleared.
+func withoutTimestamps(t *testing.T, companies []types.Company) []types.Company {
+	result := make([]types.Company, len(companies))
+	for i, c := range companies {
+		assert.False(t, c.UpdatedAt.IsZero())
+		c.UpdatedAt = time.Time{}
+		result[i] = c
+	}
+	return result
+}
+
+// staleStorage reads companies as they were before the latest update, like a
+// transaction which has read them before a concurrent one has committed.
+type staleStorage struct {
+	types.Storage
+}
+
+func (s staleStorage) Tx(ctx context.Context, action func(types.Tx) error) error {
+	return s.Storage.Tx(ctx, func(tx types.Tx) error {
+		return action(staleTx{tx})
+	})
+}
+
+type staleTx struct {
+	types.Tx
+}
+
+func (tx staleTx) Get(f filter.Filter) ([]types.Company, error) {
+	companies, err := tx.Tx.Get(f)
+	for i := range companies {
+		companies[i].Version--
+	}
+	return companies, err
+}
+
+func TestDeleteConcurrentUpdate(t *testing.T) {
+	storage := mockdb.New()
+	svc := New(storage)
+	ctx := context.Background()
+	company := types.Company{Name: "Hydrogen", Code: "HYDRO", Country: "CY"}
+	id, err := svc.Create(ctx, company)
+	require.NoError(t, err)
+	company.Id = id
+	company.Code = "H"
+	require.NoError(t, svc.Update(ctx, company))
+
+	// the version read is 1, while the stored one is 2 already
+	require.Equal(t, types.ErrVersionMismatch, New(staleStorage{storage}).Delete(ctx, id, 1))
+	got, err := svc.Get(ctx, filter.Filter{})
+	require.NoError(t, err)
+	assert.Len(t, got, 1)
+}
+
+func TestImport(t *testing.T) {
+	svc := New(mockdb.New())
+	ctx := context.Background()
+
+	existing := types.Company{Name: "Hydrogen", Code: "HYDRO", Country: "US"}
+	var err error
+	existing.Id, err = svc.Create(ctx, existing)
+	require.NoError(t, err)
+
+	invalidCountry := validation.Errors{{
+		Field:   "country",
+		Code:    validation.CodeUnknownCountry,
+		Message: "country must be an ISO 3166-1 alpha-2 code",
+	}}
+	changed := existing
+	changed.Code = "H"
+	rows := []types.Company{
+		{Name: "Beryllium", Code: "BERYL", Country: "FR"},
+		{Name: "Atlantis", Code: "ATL", Country: "Atlantis"},
+		changed,
+	}
+
+	// dry run reports the outcome but stores nothing
+	results, err := svc.Import(ctx, rows, ImportOptions{DryRun: true, Upsert: true})
+	require.NoError(t, err)
+	assert.Equal(t, []ImportResult{
+		{Action: ImportCreated},
+		{Action: ImportFailed, Err: invalidCountry},
+		{Id: existing.Id, Action: ImportUpdated},
+	}, results)
+	got, err := svc.Get(ctx, filter.Filter{})
+	require.NoError(t, err)
+	assert.Len(t, got, 1)
+
+	// without upsert existing companies are reported
+	results, err = svc.Import(ctx, rows, ImportOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []ImportResult{
+		{Id: 2, Action: ImportCreated},
+		{Action: ImportFailed, Err: invalidCountry},
+		{Action: ImportFailed, Err: types.ErrAlreadyExists},
+	}, results)
+
+	// with upsert they are updated and the rest is left unchanged
+	results, err = svc.Import(ctx, rows, ImportOptions{Upsert: true})
+	require.NoError(t, err)
+	assert.Equal(t, []ImportResult{
+		{Id: 2, Action: ImportUnchanged},
+		{Action: ImportFailed, Err: invalidCountry},
+		{Id: existing.Id, Action: ImportUpdated},
+	}, results)
+	got, err = svc.Get(ctx, filter.Filter{Expr: "id = $1", Arguments: []interface{}{existing.Id}})
+	require.NoError(t, err)
+	changed.Version = 2
+	assert.Equal(t, []types.Company{changed}, withoutTimestamps(t, got))
+}
+
+func TestReserveKey(t *testing.T) {
+	svc := New(mockdb.New())
+	ctx := context.Background()
+
+	_, reserved, err := svc.ReserveKey(ctx, "key", "request", time.Hour)
+	require.NoError(t, err)
+	require.True(t, reserved)
+
+	stored, reserved, err := svc.ReserveKey(ctx, "key", "request", time.Hour)
+	require.NoError(t, err)
+	assert.False(t, reserved)
+	assert.Equal(t, 0, stored.Status)
+
+	require.NoError(t, svc.SaveResponse(ctx, types.Response{Key: "key", Status: 201, ContentType: "application/json", Body: []byte(`{"id":1}`)}))
+	stored, reserved, err = svc.ReserveKey(ctx, "key", "other request", time.Hour)
+	require.NoError(t, err)
+	assert.False(t, reserved)
+	assert.Equal(t, "request", stored.Fingerprint)
+	assert.Equal(t, 201, stored.Status)
+	assert.Equal(t, `{"id":1}`, string(stored.Body))
+
+	// expired keys can be used again
+	_, reserved, err = svc.ReserveKey(ctx, "key", "other request", 0)
+	require.NoError(t, err)
+	assert.True(t, reserved)
+
+	require.NoError(t, svc.ReleaseKey(ctx, "key"))
+	_, reserved, err = svc.ReserveKey(ctx, "key", "request", time.Hour)
+	require.NoError(t, err)
+	assert.True(t, reserved)
+}
+
+func TestAudit(t *testing.T) {
+	svc := New(mockdb.New())
+	var entries []AuditEntry
+	svc.audit = func(e AuditEntry) { entries = append(entries, e) }
+	client := types.Client{IP: netip.MustParseAddr("5.5.5.5"), Country: "CY"}
+	ctx := types.WithClient(context.Background(), client)
+	hydrogen := types.Company{Name: "Hydrogen", Code: "HYDRO", Country: "CY"}
+
+	id, err := svc.Create(ctx, hydrogen)
+	require.NoError(t, err)
+	hydrogen.Id = id
+	hydrogen.Code = "H"
+	require.NoError(t, svc.Update(context.Background(), hydrogen))
+	_, err = svc.Create(ctx, types.Company{Name: "Hydrogen", Code: "OTHER", Country: "CY"})
+	require.Equal(t, types.ErrAlreadyExists, err)
+	// nothing is written for an identical company or an update without changes
+	_, err = svc.Create(ctx, hydrogen)
+	require.NoError(t, err)
+	require.NoError(t, svc.Update(ctx, hydrogen))
+	results, err := svc.Bulk(ctx, []Operation{
+		{Kind: OpCreate, Company: hydrogen},
+		{Kind: OpUpdate, Company: hydrogen},
+	}, false)
+	require.NoError(t, err)
+	require.NoError(t, results[0].Err)
+	require.NoError(t, results[1].Err)
+	results, err = svc.Bulk(ctx, []Operation{
+		{Kind: OpCreate, Company: types.Company{Name: "Helium", Code: "HE", Country: "CY"}},
+		{Kind: OpDelete, Company: types.Company{Id: id}},
+	}, true)
+	require.NoError(t, err)
+	_, err = svc.Import(ctx, []types.Company{{Name: "Lithium", Code: "LI", Country: "CY"}}, ImportOptions{DryRun: true})
+	require.NoError(t, err)
+
+	assert.Equal(t, []AuditEntry{
+		{OpCreate, id, client},
+		{OpUpdate, id, types.Client{}},
+		{OpCreate, results[0].Id, client},
+		{OpDelete, id, client},
+	}, entries, "failed changes, changes without effect and dry runs are not audited")
+	assert.Equal(t, "5.5.5.5 (CY)", client.String())
+	assert.Equal(t, "unknown client", types.Client{}.String())
 }
@@ -0,0 +1,37 @@
+package types
+
+import (
+	"context"
+	"net/netip"
+)
+
+// Client describes who made a request as far as it is known.
+type Client struct {
+	IP netip.Addr
+	// Country is ISO 3166-1 alpha-2 code, empty if the country has not been looked up
+	// or the address is not located in any country.
+	Country string
+}
+
+func (c Client) String() string {
+	switch {
+	case !c.IP.IsValid():
+		return "unknown client"
+	case c.Country == "":
+		return c.IP.String()
+	}
+	return c.IP.String() + " (" + c.Country + ")"
+}
+
+type clientKey struct{}
+
+// WithClient returns a copy of the context carrying the client.
+func WithClient(ctx context.Context, c Client) context.Context {
+	return context.WithValue(ctx, clientKey{}, c)
+}
+
+// ClientFromContext returns the client stored in the context with WithClient.
+func ClientFromContext(ctx context.Context) (Client, bool) {
+	c, ok := ctx.Value(clientKey{}).(Client)
+	return c, ok
+}
@@ -2,6 +2,7 @@ package types
 
 import (
 	"context"
+	"time"
 
 	"github.com/irmatov/companies/filter"
 )
@@ -13,6 +14,22 @@ type Company struct {
 	Country string
 	Website string
 	Phone   string
+	Version int
+	// UpdatedAt is maintained by the storage and is reported via HTTP headers only.
+	UpdatedAt time.Time `json:"-"`
+}
+
+// Response is an HTTP response stored for an idempotency key, so a retried request
+// gets the response of the first attempt instead of being applied again.
+type Response struct {
+	Key string
+	// Fingerprint identifies the request the key has been used with first.
+	Fingerprint string
+	// Status is zero while the first request is still being processed.
+	Status      int
+	ContentType string
+	Body        []byte
+	CreatedAt   time.Time
 }
 
 type Storage interface {
@@ -21,16 +38,31 @@ type Storage interface {
 
 type Tx interface {
 	Get(f filter.Filter) ([]Company, error)
+	// Iterate calls fn for each company that matches the filter without collecting
+	// them in memory. Iteration stops at the first error, which is returned.
+	Iterate(f filter.Filter, fn func(Company) error) error
 	Create(c Company) (int, error)
 	Update(c Company) error
-	Delete(id int) error
+	// Delete deletes the company with the given id and version, zero version matches
+	// any. ErrVersionMismatch is returned if the company has another version.
+	Delete(id int, version int) error
+
+	// GetResponse returns the response stored for the idempotency key or ErrNotFound.
+	GetResponse(key string) (Response, error)
+	// CreateResponse stores a response for a new key, ErrAlreadyExists is returned
+	// if the key is taken.
+	CreateResponse(r Response) error
+	UpdateResponse(r Response) error
+	DeleteResponse(key string) error
+	// ExpireResponses deletes the responses created before the given time.
+	ExpireResponses(before time.Time) error
 }
 
 type CompanyService interface {
 	Get(ctx context.Context, f filter.Filter) ([]Company, error)
 	Create(ctx context.Context, c Company) (int, error)
 	Update(ctx context.Context, c Company) error
-	Delete(ctx context.Context, id int) error
+	Delete(ctx context.Context, id int, version int) error
 }
 
 type Error string
@@ -40,6 +72,9 @@ func (e Error) Error() string {
 }
 
 const (
-	ErrAlreadyExists = Error("already exists")
-	ErrNotFound      = Error("not found")
+	ErrAlreadyExists    = Error("already exists")
+	ErrNotFound         = Error("not found")
+	ErrVersionMismatch  = Error("version mismatch")
+	ErrAborted          = Error("aborted")
+	ErrUnknownOperation = Error("unknown operation")
 )
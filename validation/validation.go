@@ -0,0 +1,147 @@
+// Package validation checks company attributes before they are stored.
+// All the problems found in a company are reported at once.
+package validation
+
+import (
+	_ "embed"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/irmatov/companies/types"
+)
+
+// Error codes of field errors.
+const (
+	CodeRequired       = "required"
+	CodeSurroundSpaces = "surrounding_spaces"
+	CodeTooLong        = "too_long"
+	CodeInvalidFormat  = "invalid_format"
+	CodeUnknownCountry = "unknown_country"
+)
+
+const (
+	maxNameLength = 255
+	maxURLLength  = 2048
+)
+
+// FieldError describes a problem with a single company attribute.
+type FieldError struct {
+	Field   string
+	Code    string
+	Message string
+}
+
+// Errors lists all the problems found in a company.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, fe := range e {
+		messages[i] = fe.Field + ": " + fe.Message
+	}
+	return "invalid company: " + strings.Join(messages, "; ")
+}
+
+// countries is a list of ISO 3166-1 alpha-2 country codes followed by the short country names.
+//
+//go:embed countries.txt
+var countries string
+
+var countryNames, countryCodes = parseCountries(countries)
+
+// parseCountries returns country names by codes and country codes by lower case names.
+func parseCountries(table string) (map[string]string, map[string]string) {
+	names := make(map[string]string)
+	codes := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(table), "\n") {
+		code, name, _ := strings.Cut(line, " ")
+		names[code] = name
+		codes[strings.ToLower(name)] = code
+	}
+	return names, codes
+}
+
+var (
+	// codePattern allows short identifiers made of upper case letters, digits, dashes and underscores.
+	codePattern = regexp.MustCompile(`^[A-Z0-9][A-Z0-9_-]{0,31}$`)
+	// phonePattern is an E.164 phone number: a plus sign followed by up to 15 digits.
+	phonePattern = regexp.MustCompile(`^\+[1-9][0-9]{1,14}$`)
+)
+
+// IsCountryCode reports whether s is an ISO 3166-1 alpha-2 country code.
+func IsCountryCode(s string) bool {
+	_, ok := countryNames[s]
+	return ok
+}
+
+// LookupCountry returns the ISO 3166-1 alpha-2 code of a country given either
+// its code or its short name, both case insensitive.
+func LookupCountry(s string) (string, bool) {
+	if code := strings.ToUpper(s); IsCountryCode(code) {
+		return code, true
+	}
+	code, ok := countryCodes[strings.ToLower(s)]
+	return code, ok
+}
+
+// IsPhone reports whether s is a phone number in E.164 format.
+func IsPhone(s string) bool {
+	return phonePattern.MatchString(s)
+}
+
+// IsWebsite reports whether s is an absolute http or https URL.
+func IsWebsite(s string) bool {
+	if len(s) > maxURLLength || strings.ContainsAny(s, " \t\r\n") {
+		return false
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && u.Hostname() != "" && u.User == nil
+}
+
+// Company checks the company attributes. Name, code and country are mandatory,
+// website and phone may be left empty. The returned error, if any, is of Errors type.
+func Company(c types.Company) error {
+	var errs Errors
+	add := func(field, code, message string) {
+		errs = append(errs, FieldError{field, code, message})
+	}
+
+	switch {
+	case c.Name == "":
+		add("name", CodeRequired, "name is required")
+	case strings.TrimSpace(c.Name) != c.Name:
+		add("name", CodeSurroundSpaces, "name must not contain leading or trailing spaces")
+	case len(c.Name) > maxNameLength:
+		add("name", CodeTooLong, "name must not be longer than 255 bytes")
+	}
+
+	switch {
+	case c.Code == "":
+		add("code", CodeRequired, "code is required")
+	case !codePattern.MatchString(c.Code):
+		add("code", CodeInvalidFormat, "code must be up to 32 upper case letters, digits, dashes or underscores")
+	}
+
+	switch {
+	case c.Country == "":
+		add("country", CodeRequired, "country is required")
+	case !IsCountryCode(c.Country):
+		add("country", CodeUnknownCountry, "country must be an ISO 3166-1 alpha-2 code")
+	}
+
+	if c.Website != "" && !IsWebsite(c.Website) {
+		add("website", CodeInvalidFormat, "website must be an absolute http or https URL")
+	}
+	if c.Phone != "" && !IsPhone(c.Phone) {
+		add("phone", CodeInvalidFormat, "phone must be in E.164 format, e.g. +35722123456")
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
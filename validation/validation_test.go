@@ -0,0 +1,103 @@
+package validation
+
+import (
+	"testing"
+
+	"github.com/irmatov/companies/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompany(t *testing.T) {
+	valid := types.Company{
+		Name:    "Hydrogen",
+		Code:    "HYDRO-1",
+		Country: "CY",
+		Website: "https://hydrogen.io/about",
+		Phone:   "+35722123456",
+	}
+	tests := []struct {
+		name   string
+		modify func(c *types.Company)
+		want   error
+	}{
+		{"valid", func(c *types.Company) {}, nil},
+		{"optional fields", func(c *types.Company) { c.Website, c.Phone = "", "" }, nil},
+		{
+			"everything is wrong",
+			func(c *types.Company) {
+				*c = types.Company{Name: " Hydrogen", Country: "XX", Website: "ftp://hydrogen.io", Phone: "0035722123456"}
+			},
+			Errors{
+				{"name", CodeSurroundSpaces, "name must not contain leading or trailing spaces"},
+				{"code", CodeRequired, "code is required"},
+				{"country", CodeUnknownCountry, "country must be an ISO 3166-1 alpha-2 code"},
+				{"website", CodeInvalidFormat, "website must be an absolute http or https URL"},
+				{"phone", CodeInvalidFormat, "phone must be in E.164 format, e.g. +35722123456"},
+			},
+		},
+		{
+			"lower case values",
+			func(c *types.Company) { c.Code, c.Country = "hydro", "cy" },
+			Errors{
+				{"code", CodeInvalidFormat, "code must be up to 32 upper case letters, digits, dashes or underscores"},
+				{"country", CodeUnknownCountry, "country must be an ISO 3166-1 alpha-2 code"},
+			},
+		},
+		{
+			"missing name and country",
+			func(c *types.Company) { c.Name, c.Country = "", "" },
+			Errors{
+				{"name", CodeRequired, "name is required"},
+				{"country", CodeRequired, "country is required"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := valid
+			tt.modify(&c)
+			assert.Equal(t, tt.want, Company(c))
+		})
+	}
+}
+
+func TestIsWebsite(t *testing.T) {
+	for s, want := range map[string]bool{
+		"http://example.com":           true,
+		"https://example.com:8443/x?y": true,
+		"example.com":                  false,
+		"/relative/path":               false,
+		"mailto:info@example.com":      false,
+		"https://user:pw@example.com":  false,
+		"https://exa mple.com":         false,
+		"https://":                     false,
+	} {
+		assert.Equal(t, want, IsWebsite(s), s)
+	}
+}
+
+func TestIsPhone(t *testing.T) {
+	for s, want := range map[string]bool{
+		"+35722123456":      true,
+		"+1234567890":       true,
+		"35722123456":       false,
+		"+0123456":          false,
+		"+357 22 123456":    false,
+		"+1234567890123456": false,
+	} {
+		assert.Equal(t, want, IsPhone(s), s)
+	}
+}
+
+func TestCountries(t *testing.T) {
+	assert.Len(t, countryNames, 249)
+	assert.True(t, IsCountryCode("CY"))
+	assert.False(t, IsCountryCode("UK"))
+	assert.False(t, IsCountryCode("cy"))
+
+	for s, want := range map[string]string{"CY": "CY", "cy": "CY", "Cyprus": "CY", "united kingdom": "GB", "Atlantis": ""} {
+		code, ok := LookupCountry(s)
+		assert.Equal(t, want, code, s)
+		assert.Equal(t, want != "", ok, s)
+	}
+}